@@ -0,0 +1,358 @@
+package mydumper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// kind of a file in a mydumper output directory.
+type FileKind string
+
+const (
+	// metadata
+	FileMetadata FileKind = "metadata"
+	// db-schema-create.sql
+	FileDatabaseSchema FileKind = "database-schema"
+	// db-schema-post.sql, routines and events.
+	FilePost FileKind = "post"
+	// db.table-schema.sql
+	FileTableSchema FileKind = "table-schema"
+	// db.table-schema-view.sql
+	FileView FileKind = "view"
+	// db.table-schema-triggers.sql
+	FileTriggers FileKind = "triggers"
+	// db.table.sql or db.table.00001.sql
+	FileData FileKind = "data"
+	// manifest.json, see WriteManifest.
+	FileManifest FileKind = "manifest"
+	// anything else, such as a metadata.partial left by a crash.
+	FileUnknown FileKind = "unknown"
+)
+
+type (
+	// one file of a backup.
+	BackupFile struct {
+		Name     string   `json:"name"`
+		Kind     FileKind `json:"kind"`
+		Database string   `json:"database,omitempty"`
+		Table    string   `json:"table,omitempty"`
+		// sequence number of a data chunk, -1 when the table is in one file.
+		Chunk      int    `json:"chunk"`
+		Compressed bool   `json:"compressed"`
+		Size       uint64 `json:"size"`
+	}
+
+	// files of one table or view.
+	BackupTable struct {
+		Name   string      `json:"name"`
+		Schema *BackupFile `json:"schema,omitempty"`
+		View   *BackupFile `json:"view,omitempty"`
+		// data files, sorted by chunk.
+		Chunks   []BackupFile `json:"chunks"`
+		Triggers *BackupFile  `json:"triggers,omitempty"`
+	}
+
+	// files of one database.
+	BackupDatabase struct {
+		Name   string      `json:"name"`
+		Schema *BackupFile `json:"schema,omitempty"`
+		Post   *BackupFile `json:"post,omitempty"`
+		// sorted by name.
+		Tables []*BackupTable `json:"tables"`
+	}
+
+	// inventory of a mydumper output directory, see ScanBackup.
+	Backup struct {
+		Dir string `json:"dir"`
+		// parsed metadata file, nil when it is missing or unreadable.
+		Meta *MetaData `json:"meta,omitempty"`
+		// sorted by name.
+		Databases []*BackupDatabase `json:"databases"`
+		// every file, sorted by name.
+		Files []BackupFile `json:"files"`
+		// bytes in Files.
+		Size uint64 `json:"size"`
+	}
+)
+
+// classify a file name of a mydumper output directory.
+func parseBackupFile(name string) BackupFile {
+	f := BackupFile{Name: name, Kind: FileUnknown, Chunk: -1}
+
+	base := name
+	if strings.HasSuffix(base, ".gz") {
+		base = strings.TrimSuffix(base, ".gz")
+		f.Compressed = true
+	}
+	if base == "metadata" && !f.Compressed {
+		f.Kind = FileMetadata
+		return f
+	}
+	if name == ManifestName {
+		f.Kind = FileManifest
+		return f
+	}
+	if !strings.HasSuffix(base, ".sql") {
+		return f
+	}
+	base = strings.TrimSuffix(base, ".sql")
+
+	// database files have no dot, table files exactly one before the suffix.
+	database := func(suffix string, kind FileKind) bool {
+		if !strings.HasSuffix(base, suffix) {
+			return false
+		}
+		db := strings.TrimSuffix(base, suffix)
+		if len(db) == 0 || strings.Contains(db, ".") {
+			return false
+		}
+		f.Kind, f.Database = kind, db
+		return true
+	}
+	table := func(suffix string, kind FileKind) bool {
+		if !strings.HasSuffix(base, suffix) {
+			return false
+		}
+		parts := strings.Split(strings.TrimSuffix(base, suffix), ".")
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return false
+		}
+		f.Kind, f.Database, f.Table = kind, parts[0], parts[1]
+		return true
+	}
+
+	switch {
+	case database("-schema-create", FileDatabaseSchema):
+	case database("-schema-post", FilePost):
+	case table("-schema-view", FileView):
+	case table("-schema-triggers", FileTriggers):
+	case table("-schema", FileTableSchema):
+	case strings.Contains(base, "-schema"):
+		// a schema file of an unknown kind.
+	default:
+		parts := strings.Split(base, ".")
+		if len(parts) < 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			return f
+		}
+		switch {
+		case len(parts) == 2:
+		case len(parts) == 3 && isDigits(parts[2]):
+			chunk, err := strconv.Atoi(parts[2])
+			if err != nil {
+				return f
+			}
+			f.Chunk = chunk
+		default:
+			return f
+		}
+		f.Kind, f.Database, f.Table = FileData, parts[0], parts[1]
+	}
+	return f
+}
+
+// scan the files mydumper wrote to dir. subdirectories, such as the snapshot
+// directories of daemon mode, and hidden files such as the lock file are not
+// part of the backup.
+func ScanBackup(dir string) (*Backup, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	b := new(Backup)
+	b.Dir = dir
+	b.Databases = make([]*BackupDatabase, 0)
+	b.Files = make([]BackupFile, 0, len(infos))
+
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		f := parseBackupFile(info.Name())
+		f.Size = uint64(info.Size())
+		b.Files = append(b.Files, f)
+		b.Size += f.Size
+	}
+	sort.Slice(b.Files, func(i, j int) bool {
+		return b.Files[i].Name < b.Files[j].Name
+	})
+
+	for i := range b.Files {
+		b.add(&b.Files[i])
+	}
+	for _, db := range b.Databases {
+		for _, t := range db.Tables {
+			sort.Slice(t.Chunks, func(i, j int) bool {
+				return t.Chunks[i].Chunk < t.Chunks[j].Chunk
+			})
+		}
+	}
+
+	if b.has(FileMetadata) {
+		meta, err := NewMeta(dir)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err := meta.ReadMetadata(); err == nil {
+			b.Meta = meta
+		}
+	}
+	return b, nil
+}
+
+func (b *Backup) add(f *BackupFile) {
+	if len(f.Database) == 0 {
+		return
+	}
+	db := b.database(f.Database, true)
+
+	switch f.Kind {
+	case FileDatabaseSchema:
+		db.Schema = f
+		return
+	case FilePost:
+		db.Post = f
+		return
+	}
+
+	t := db.table(f.Table, true)
+	switch f.Kind {
+	case FileTableSchema:
+		t.Schema = f
+	case FileView:
+		t.View = f
+	case FileTriggers:
+		t.Triggers = f
+	case FileData:
+		t.Chunks = append(t.Chunks, *f)
+	}
+}
+
+func (b *Backup) has(kind FileKind) bool {
+	for _, f := range b.Files {
+		if f.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Backup) database(name string, create bool) *BackupDatabase {
+	i := sort.Search(len(b.Databases), func(i int) bool {
+		return b.Databases[i].Name >= name
+	})
+	if i < len(b.Databases) && b.Databases[i].Name == name {
+		return b.Databases[i]
+	}
+	if !create {
+		return nil
+	}
+
+	db := &BackupDatabase{Name: name, Tables: make([]*BackupTable, 0)}
+	b.Databases = append(b.Databases, nil)
+	copy(b.Databases[i+1:], b.Databases[i:])
+	b.Databases[i] = db
+	return db
+}
+
+func (db *BackupDatabase) table(name string, create bool) *BackupTable {
+	i := sort.Search(len(db.Tables), func(i int) bool {
+		return db.Tables[i].Name >= name
+	})
+	if i < len(db.Tables) && db.Tables[i].Name == name {
+		return db.Tables[i]
+	}
+	if !create {
+		return nil
+	}
+
+	t := &BackupTable{Name: name, Chunks: make([]BackupFile, 0)}
+	db.Tables = append(db.Tables, nil)
+	copy(db.Tables[i+1:], db.Tables[i:])
+	db.Tables[i] = t
+	return t
+}
+
+// database name, nil when not in the backup.
+func (b *Backup) Database(name string) *BackupDatabase {
+	return b.database(name, false)
+}
+
+// table name of the database, nil when not in the backup.
+func (db *BackupDatabase) Table(name string) *BackupTable {
+	return db.table(name, false)
+}
+
+// files of the given kinds, every file when none is given.
+func (b *Backup) FilesOf(kinds ...FileKind) []BackupFile {
+	files := make([]BackupFile, 0, len(b.Files))
+	for _, f := range b.Files {
+		if len(kinds) == 0 {
+			files = append(files, f)
+			continue
+		}
+		for _, kind := range kinds {
+			if f.Kind == kind {
+				files = append(files, f)
+				break
+			}
+		}
+	}
+	return files
+}
+
+// bytes in the data files of the table.
+func (t *BackupTable) DataSize() uint64 {
+	var size uint64
+	for _, chunk := range t.Chunks {
+		size += chunk.Size
+	}
+	return size
+}
+
+// structural problems of the backup: missing or unfinished metadata,
+// data without a table schema, gaps in chunk numbers and unknown files.
+func (b *Backup) Problems() []string {
+	problems := make([]string, 0)
+
+	switch {
+	case !b.has(FileMetadata):
+		problems = append(problems, "metadata file is missing")
+	case b.Meta == nil:
+		problems = append(problems, "metadata file cannot be read")
+	case !b.Meta.Completed:
+		problems = append(problems, "metadata file has no finish time, the dump did not complete")
+	}
+
+	for _, db := range b.Databases {
+		for _, t := range db.Tables {
+			name := db.Name + "." + t.Name
+			if len(t.Chunks) > 0 && t.Schema == nil {
+				problems = append(problems, fmt.Sprintf("%s has data but no schema file", name))
+			}
+			for i := 1; i < len(t.Chunks); i++ {
+				prev, cur := t.Chunks[i-1].Chunk, t.Chunks[i].Chunk
+				if prev < 0 {
+					problems = append(problems, fmt.Sprintf("%s has both a single data file and chunks", name))
+					break
+				}
+				if cur != prev+1 {
+					problems = append(problems, fmt.Sprintf("%s is missing chunks between %d and %d", name, prev, cur))
+				}
+			}
+		}
+	}
+
+	for _, f := range b.Files {
+		if f.Kind == FileUnknown {
+			problems = append(problems, fmt.Sprintf("unknown file %s", filepath.Base(f.Name)))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,123 @@
+package mydumper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseBackupFile(t *testing.T) {
+
+	cases := []BackupFile{
+		{Name: "metadata", Kind: FileMetadata, Chunk: -1},
+		{Name: "metadata.partial", Kind: FileUnknown, Chunk: -1},
+		{Name: "dev-schema-create.sql", Kind: FileDatabaseSchema, Database: "dev", Chunk: -1},
+		{Name: "dev-schema-post.sql.gz", Kind: FilePost, Database: "dev", Chunk: -1, Compressed: true},
+		{Name: "dev.t1-schema.sql", Kind: FileTableSchema, Database: "dev", Table: "t1", Chunk: -1},
+		{Name: "dev.v1-schema-view.sql", Kind: FileView, Database: "dev", Table: "v1", Chunk: -1},
+		{Name: "dev.t1-schema-triggers.sql", Kind: FileTriggers, Database: "dev", Table: "t1", Chunk: -1},
+		{Name: "dev.t1.sql", Kind: FileData, Database: "dev", Table: "t1", Chunk: -1},
+		{Name: "dev.t1.00002.sql.gz", Kind: FileData, Database: "dev", Table: "t1", Chunk: 2, Compressed: true},
+		{Name: "dev.t1.abc.sql", Kind: FileUnknown, Chunk: -1},
+		{Name: "notes.txt", Kind: FileUnknown, Chunk: -1},
+	}
+
+	for _, expected := range cases {
+		if got := parseBackupFile(expected.Name); got != expected {
+			t.Errorf("%s: expected %+v, got %+v", expected.Name, expected, got)
+		}
+	}
+}
+
+func TestScanBackup(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	meta, err := ioutil.ReadFile("testdata/legacy/metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"metadata":                   string(meta),
+		"dev-schema-create.sql":      "CREATE DATABASE dev;",
+		"dev.t1-schema.sql":          "CREATE TABLE t1 (id int);",
+		"dev.t1.00000.sql":           "INSERT INTO t1 VALUES (1);",
+		"dev.t1.00001.sql":           "INSERT INTO t1 VALUES (2);",
+		"dev.t1.00003.sql":           "INSERT INTO t1 VALUES (4);",
+		"dev.t2.sql":                 "INSERT INTO t2 VALUES (1);",
+		"dev.v1-schema-view.sql":     "CREATE VIEW v1 AS SELECT 1;",
+		"app-schema-create.sql":      "CREATE DATABASE app;",
+		"app.users-schema.sql.gz":    "x",
+		"app.users.sql.gz":           "xx",
+		"app-schema-post.sql":        "",
+		"metadata.partial":           "",
+		"dev.t1-schema-triggers.sql": "",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "0"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ScanBackup(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b.Files) != len(files) {
+		t.Errorf("expected %d files, got %d", len(files), len(b.Files))
+	}
+	if b.Meta == nil || b.Meta.BinLogFilePos != 154 {
+		t.Errorf("unexpected metadata %+v", b.Meta)
+	}
+	if len(b.Databases) != 2 || b.Databases[0].Name != "app" || b.Databases[1].Name != "dev" {
+		t.Fatalf("unexpected databases %+v", b.Databases)
+	}
+
+	dev := b.Database("dev")
+	if dev.Schema == nil || len(dev.Tables) != 3 {
+		t.Fatalf("unexpected database %+v", dev)
+	}
+	t1 := dev.Table("t1")
+	if t1.Schema == nil || t1.Triggers == nil || len(t1.Chunks) != 3 || t1.Chunks[2].Chunk != 3 {
+		t.Errorf("unexpected table %+v", t1)
+	}
+	if t1.DataSize() != 78 {
+		t.Errorf("unexpected data size %d", t1.DataSize())
+	}
+	if v1 := dev.Table("v1"); v1 == nil || v1.View == nil {
+		t.Errorf("unexpected view %+v", v1)
+	}
+	if app := b.Database("app"); app.Post == nil || !app.Table("users").Chunks[0].Compressed {
+		t.Errorf("unexpected database %+v", app)
+	}
+	if b.Database("none") != nil || dev.Table("none") != nil {
+		t.Error("expected nil for missing objects")
+	}
+	if n := len(b.FilesOf(FileData)); n != 5 {
+		t.Errorf("expected 5 data files, got %d", n)
+	}
+
+	problems := strings.Join(b.Problems(), "\n")
+	for _, expected := range []string{
+		"dev.t1 is missing chunks between 1 and 3",
+		"dev.t2 has data but no schema file",
+		"unknown file metadata.partial",
+	} {
+		if !strings.Contains(problems, expected) {
+			t.Errorf("missing %q in %q", expected, problems)
+		}
+	}
+	if strings.Contains(problems, "metadata file") {
+		t.Errorf("unexpected metadata problem in %q", problems)
+	}
+}
@@ -0,0 +1,354 @@
+package mydumper
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// database/sql driver NewCatalog opens the catalog file with. it is
+// registered by importing github.com/imSQL/go-mydumper/sqlite, which needs cgo.
+const CatalogDriver = "sqlite3"
+
+type (
+	// backup catalog in a SQLite file, one Recorder per backup.
+	Catalog struct {
+		// empty for a catalog opened with NewCatalogDB.
+		Path string `json:"path" db:"path"`
+
+		db *sql.DB
+	}
+
+	// conditions for Catalog.List. zero values match every record.
+	RecordFilter struct {
+		States     []BackupState `json:"states"`
+		Operations []Operation   `json:"operations"`
+		// StartTimestamp at or after Since.
+		Since time.Time `json:"since"`
+		// StartTimestamp before Until.
+		Until     time.Time `json:"until"`
+		BackupDir string    `json:"backup_dir"`
+	}
+)
+
+// open the catalog in the SQLite file path, creating the file when missing
+// and applying pending schema migrations. the CatalogDriver must be
+// registered, see NewCatalogDB to use another SQLite driver.
+func NewCatalog(path string) (*Catalog, error) {
+	if len(path) == 0 {
+		return nil, errors.NotValidf("empty catalog path")
+	}
+	if !driverRegistered(CatalogDriver) {
+		return nil, errors.NewNotSupported(nil, "catalog without the "+CatalogDriver+
+			" driver, import github.com/imSQL/go-mydumper/sqlite")
+	}
+
+	db, err := sql.Open(CatalogDriver, path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	// SQLite allows one writer, serialize in the pool instead of failing with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	c, err := NewCatalogDB(db)
+	if err != nil {
+		db.Close()
+		return nil, errors.Annotatef(err, "catalog %s", path)
+	}
+	c.Path = path
+	return c, nil
+}
+
+// use the SQLite database db as catalog, applying pending schema
+// migrations. db should allow one open connection. Close closes it.
+func NewCatalogDB(db *sql.DB) (*Catalog, error) {
+	if db == nil {
+		return nil, errors.NotValidf("nil catalog database")
+	}
+	if err := migrate(db, migrations); err != nil {
+		return nil, errors.Annotate(err, "migrate schema")
+	}
+
+	c := new(Catalog)
+	c.db = db
+	return c, nil
+}
+
+func driverRegistered(name string) bool {
+	for _, driver := range sql.Drivers() {
+		if driver == name {
+			return true
+		}
+	}
+	return false
+}
+
+// close the catalog database.
+func (c *Catalog) Close() error {
+	return errors.Trace(c.db.Close())
+}
+
+// insert r and set its Id.
+func (c *Catalog) Insert(r *Recorder) error {
+	res, err := c.db.Exec(StmtInsertRecord,
+		r.Type, r.Method, r.State, r.BackupDir,
+		r.BinLogFileName, r.BinLogFilePos, r.BinLogUuid,
+		catalogTime(r.StartTimestamp), catalogTime(r.EndTimestamp), r.Message,
+		r.Size, r.Checksum, r.ServerUuid, r.MydumperVersion, r.Labels, r.Operation)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	r.Id = uint64(id)
+	return nil
+}
+
+// update every field of the record with r.Id.
+// fails when the stored state cannot move to r.State.
+func (c *Catalog) Update(r *Recorder) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer tx.Rollback()
+
+	var state BackupState
+	err = tx.QueryRow(StmtQueryRecordState, r.Id).Scan(&state)
+	if err == sql.ErrNoRows {
+		return errors.NotFoundf("backup record %d", r.Id)
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := checkTransition(state, r.State); err != nil {
+		return errors.Annotatef(err, "backup record %d", r.Id)
+	}
+
+	_, err = tx.Exec(StmtUpdateRecord,
+		r.Type, r.Method, r.State, r.BackupDir,
+		r.BinLogFileName, r.BinLogFilePos, r.BinLogUuid,
+		catalogTime(r.StartTimestamp), catalogTime(r.EndTimestamp), r.Message,
+		r.Size, r.Checksum, r.ServerUuid, r.MydumperVersion, r.Labels, r.Operation,
+		r.Id)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(tx.Commit())
+}
+
+// delete the record with id.
+func (c *Catalog) Delete(id uint64) error {
+	res, err := c.db.Exec(StmtDeleteRecord, id)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(affectedOne(res, id))
+}
+
+// record with id.
+func (c *Catalog) Get(id uint64) (*Recorder, error) {
+	records, err := c.query(StmtQueryRecord+" WHERE id = ?", id)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(records) == 0 {
+		return nil, errors.NotFoundf("backup record %d", id)
+	}
+	return records[0], nil
+}
+
+// records matching f, oldest first.
+func (c *Catalog) List(f RecordFilter) ([]*Recorder, error) {
+	conds := make([]string, 0, 5)
+	args := make([]interface{}, 0, len(f.States)+len(f.Operations)+3)
+
+	if len(f.States) > 0 {
+		marks := make([]string, 0, len(f.States))
+		for _, state := range f.States {
+			marks = append(marks, "?")
+			args = append(args, state)
+		}
+		conds = append(conds, "state IN ("+strings.Join(marks, ",")+")")
+	}
+	if len(f.Operations) > 0 {
+		marks := make([]string, 0, len(f.Operations))
+		for _, op := range f.Operations {
+			marks = append(marks, "?")
+			args = append(args, op)
+		}
+		conds = append(conds, "operation IN ("+strings.Join(marks, ",")+")")
+	}
+	if !f.Since.IsZero() {
+		conds = append(conds, "start_timestamp >= ?")
+		args = append(args, catalogTime(f.Since))
+	}
+	if !f.Until.IsZero() {
+		conds = append(conds, "start_timestamp < ?")
+		args = append(args, catalogTime(f.Until))
+	}
+	if len(f.BackupDir) > 0 {
+		conds = append(conds, "backup_dir = ?")
+		args = append(args, f.BackupDir)
+	}
+
+	stmt := StmtQueryRecord
+	if len(conds) > 0 {
+		stmt += " WHERE " + strings.Join(conds, " AND ")
+	}
+	stmt += " ORDER BY start_timestamp, id"
+
+	records, err := c.query(stmt, args...)
+	return records, errors.Trace(err)
+}
+
+func (c *Catalog) query(stmt string, args ...interface{}) ([]*Recorder, error) {
+	rows, err := c.db.Query(stmt, args...)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	records := make([]*Recorder, 0)
+	for rows.Next() {
+		r := new(Recorder)
+		var uuid sql.NullString
+		err := rows.Scan(&r.Id, &r.Type, &r.Method, &r.State, &r.BackupDir,
+			&r.BinLogFileName, &r.BinLogFilePos, &uuid,
+			&r.StartTimestamp, &r.EndTimestamp, &r.Message,
+			&r.Size, &r.Checksum, &r.ServerUuid, &r.MydumperVersion, &r.Labels, &r.Operation)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		r.BinLogUuid = uuid.String
+		r.StartTimestamp = r.StartTimestamp.Local()
+		r.EndTimestamp = r.EndTimestamp.Local()
+		records = append(records, r)
+	}
+	return records, errors.Trace(rows.Err())
+}
+
+// timestamps are stored in UTC so they compare as text.
+func catalogTime(t time.Time) time.Time {
+	return t.UTC()
+}
+
+func affectedOne(res sql.Result, id uint64) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if n == 0 {
+		return errors.NotFoundf("backup record %d", id)
+	}
+	return nil
+}
+
+// insert a running record for a run of version on dir. nil when c is nil.
+func startRecord(c *Catalog, op Operation, dir string, version Version) (*Recorder, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	now := time.Now()
+	r := &Recorder{
+		Type:           TypeFull,
+		Operation:      op,
+		Method:         MethodMydumper,
+		State:          StateRunning,
+		BackupDir:      dir,
+		StartTimestamp: now,
+		EndTimestamp:   now,
+	}
+	if version != (Version{}) {
+		r.MydumperVersion = version.String()
+	}
+	if err := c.Insert(r); err != nil {
+		return nil, errors.Annotate(err, "record run in catalog")
+	}
+	return r, nil
+}
+
+// mark r succeeded, failed or cancelled after a run ending with runErr, taking
+// the binlog position and, for dumps, the timestamps from the metadata in dir.
+// returns runErr, or the catalog error when the run succeeded.
+func finishRecord(c *Catalog, r *Recorder, dir string, runErr error) error {
+	if r == nil {
+		return runErr
+	}
+
+	r.EndTimestamp = time.Now()
+	switch {
+	case runErr == nil:
+		r.State = StateSucceeded
+		if err := r.fillFromMeta(dir); err != nil {
+			r.Message = "read metadata: " + err.Error()
+		}
+		if r.Operation != OperationRestore {
+			r.Size = dirSize(dir)
+		}
+		// the manifest holds the checksum of every file, so hashing it
+		// covers them, but two dumps of the same data still differ.
+		if sum, _, err := hashFile(filepath.Join(dir, ManifestName), false); err == nil {
+			r.Checksum = sum
+		}
+	case IsCancelled(runErr):
+		r.State = StateCancelled
+		r.Message = runErr.Error()
+	default:
+		r.State = StateFailed
+		r.Message = runErr.Error()
+	}
+
+	if err := c.Update(r); err != nil {
+		if runErr != nil {
+			return runErr
+		}
+		return errors.Annotatef(err, "record run in catalog")
+	}
+	return runErr
+}
+
+func (r *Recorder) fillFromMeta(dir string) error {
+	meta, err := NewMeta(dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := meta.ReadMetadata(); err != nil {
+		return errors.Trace(err)
+	}
+
+	r.BinLogFileName = meta.BinLogFileName
+	r.BinLogFilePos = meta.BinLogFilePos
+	r.BinLogUuid = meta.BinLogUuid
+
+	// a restore keeps the times of the run, not of the restored dump.
+	if r.Operation != OperationRestore {
+		if !meta.StartTimestamp.IsZero() {
+			r.StartTimestamp = meta.StartTimestamp
+		}
+		if !meta.EndTimestamp.IsZero() {
+			r.EndTimestamp = meta.EndTimestamp
+		}
+	}
+	return nil
+}
+
+// bytes in the files under dir, unreadable entries are skipped.
+func dirSize(dir string) uint64 {
+	var size uint64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += uint64(info.Size())
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,293 @@
+package mydumper
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/imSQL/go-mydumper/sqlite"
+	"github.com/juju/errors"
+)
+
+func newTestCatalog(t *testing.T) (*Catalog, func()) {
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewCatalog(filepath.Join(dir, "catalog.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return c, func() {
+		c.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNewCatalogDB(t *testing.T) {
+
+	db, err := sql.Open(CatalogDriver, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+
+	c, err := NewCatalogDB(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	r := &Recorder{State: StateRunning, BackupDir: "/backup"}
+	if err := c.Insert(r); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.Get(r.Id); err != nil || got.BackupDir != "/backup" {
+		t.Errorf("unexpected record %+v: %v", got, err)
+	}
+	if _, err := NewCatalogDB(nil); err == nil {
+		t.Error("expected error for nil database")
+	}
+}
+
+func TestCatalogCRUD(t *testing.T) {
+	c, cleanup := newTestCatalog(t)
+	defer cleanup()
+
+	start := time.Date(2018, 6, 1, 10, 0, 0, 0, time.Local)
+	r := &Recorder{
+		Type:           TypeFull,
+		Method:         MethodMydumper,
+		State:          StateRunning,
+		BackupDir:      "/backup/it's quoted",
+		BinLogFileName: "mysql-bin.000003",
+		BinLogFilePos:  154,
+		StartTimestamp: start,
+		EndTimestamp:   start,
+	}
+	if err := c.Insert(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Id == 0 {
+		t.Fatal("expected id to be set")
+	}
+
+	r.State = StateSucceeded
+	r.BinLogUuid = uuidA + ":1-5"
+	r.EndTimestamp = start.Add(time.Hour)
+	if err := c.Update(r); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Get(r.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BackupDir != r.BackupDir || got.State != StateSucceeded || got.BinLogUuid != r.BinLogUuid {
+		t.Errorf("unexpected record %+v", got)
+	}
+	if !got.StartTimestamp.Equal(start) || !got.EndTimestamp.Equal(r.EndTimestamp) {
+		t.Errorf("unexpected timestamps %s %s", got.StartTimestamp, got.EndTimestamp)
+	}
+
+	r.State = StateRunning
+	if err := c.Update(r); !errors.IsNotValid(err) {
+		t.Errorf("expected illegal transition, got %v", err)
+	}
+
+	if err := c.Delete(r.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(r.Id); !errors.IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if err := c.Delete(r.Id); !errors.IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if err := c.Update(r); !errors.IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestCatalogList(t *testing.T) {
+	c, cleanup := newTestCatalog(t)
+	defer cleanup()
+
+	base := time.Date(2018, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		r := &Recorder{
+			State:          BackupState(i % 3),
+			BackupDir:      "/backup/" + string('a'+rune(i%2)),
+			StartTimestamp: base.Add(time.Duration(i) * 24 * time.Hour),
+			EndTimestamp:   base.Add(time.Duration(i) * 24 * time.Hour),
+		}
+		if err := c.Insert(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		filter   RecordFilter
+		expected []uint64
+	}{
+		{RecordFilter{}, []uint64{1, 2, 3, 4, 5, 6}},
+		{RecordFilter{States: []BackupState{StatePending, StateSucceeded}}, []uint64{1, 3, 4, 6}},
+		{RecordFilter{Since: base.Add(48 * time.Hour)}, []uint64{3, 4, 5, 6}},
+		{RecordFilter{Since: base.Add(24 * time.Hour), Until: base.Add(72 * time.Hour)}, []uint64{2, 3}},
+		{RecordFilter{BackupDir: "/backup/b"}, []uint64{2, 4, 6}},
+		{RecordFilter{BackupDir: "/backup/b", States: []BackupState{StateRunning}}, []uint64{2}},
+		{RecordFilter{BackupDir: "' OR 1=1 --"}, []uint64{}},
+	}
+
+	for _, tc := range cases {
+		records, err := c.List(tc.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]uint64, 0, len(records))
+		for _, r := range records {
+			ids = append(ids, r.Id)
+		}
+		if len(ids) != len(tc.expected) {
+			t.Errorf("%+v: expected %v, got %v", tc.filter, tc.expected, ids)
+			continue
+		}
+		for i := range ids {
+			if ids[i] != tc.expected[i] {
+				t.Errorf("%+v: expected %v, got %v", tc.filter, tc.expected, ids)
+				break
+			}
+		}
+	}
+}
+
+func TestCatalogReopen(t *testing.T) {
+	c, cleanup := newTestCatalog(t)
+	defer cleanup()
+
+	r := &Recorder{BackupDir: "/backup", StartTimestamp: time.Now(), EndTimestamp: time.Now()}
+	if err := c.Insert(r); err != nil {
+		t.Fatal(err)
+	}
+
+	again, err := NewCatalog(c.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if _, err := again.Get(r.Id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDumpRecordsCatalog(t *testing.T) {
+	c, cleanup := newTestCatalog(t)
+	defer cleanup()
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	meta, err := filepath.Abs("testdata/legacy/metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outdir := filepath.Join(dir, "backup")
+	if err := os.Mkdir(outdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dumper := newFakeDumper(t, dir, "cp "+meta+" "+outdir+"/metadata")
+	dumper.SetOutPutDir(outdir)
+	dumper.SetCatalog(c)
+
+	if err := dumper.Dump(); err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := dumper.Record()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Get(record.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != StateSucceeded || got.Type != TypeFull || got.BackupDir != outdir || got.MydumperVersion != "0.10.0" || got.Size == 0 {
+		t.Errorf("unexpected record %+v", got)
+	}
+	if got.BinLogFileName != "mysql-bin.000003" || got.BinLogFilePos != 154 || got.BinLogUuid != uuidA+":1-5" {
+		t.Errorf("unexpected binlog position %+v", got)
+	}
+	start := time.Date(2019, 1, 1, 10, 0, 0, 0, time.Local)
+	if !got.StartTimestamp.Equal(start) || !got.EndTimestamp.Equal(start.Add(10*time.Second)) {
+		t.Errorf("unexpected timestamps %s %s", got.StartTimestamp, got.EndTimestamp)
+	}
+
+	dumper.ExecutionPath = fakeBinary(t, dir, "mydumper", "echo '** (mydumper:42): CRITICAL **: Error connecting to database: Access denied for user' >&2; exit 2")
+	if err := dumper.Dump(); err == nil {
+		t.Fatal("expected error")
+	}
+	record, err = dumper.Record()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = c.Get(record.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != StateFailed || !strings.Contains(got.Message, "Access denied") {
+		t.Errorf("unexpected record %+v", got)
+	}
+}
+
+func TestLoadRecordsCatalog(t *testing.T) {
+	c, cleanup := newTestCatalog(t)
+	defer cleanup()
+
+	dir, err := ioutil.TempDir("", "myloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	loader := newFakeLoader(t, dir, "")
+	// the load locks its directory, keep the lock file out of testdata.
+	meta, err := ioutil.ReadFile("testdata/legacy/metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(dir, "backup")
+	if err := os.Mkdir(source, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(source, "metadata"), meta, 0644); err != nil {
+		t.Fatal(err)
+	}
+	loader.SetSourceDirectory(source)
+	loader.SetCatalog(c)
+
+	before := time.Now().Add(-time.Second)
+	if err := loader.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := c.List(RecordFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected one record, got %d", len(records))
+	}
+	got := records[0]
+	if got.Operation != OperationRestore || got.Type != TypeFull || got.State != StateSucceeded || got.BinLogFilePos != 154 {
+		t.Errorf("unexpected record %+v", got)
+	}
+	if got.StartTimestamp.Before(before) {
+		t.Errorf("restore took the dump start time %s", got.StartTimestamp)
+	}
+}
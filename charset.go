@@ -0,0 +1,118 @@
+package mydumper
+
+import (
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// MySQL character sets and their default collation.
+var charsetDefaultCollation = map[string]string{
+	"armscii8": "armscii8_general_ci",
+	"ascii":    "ascii_general_ci",
+	"big5":     "big5_chinese_ci",
+	"binary":   "binary",
+	"cp1250":   "cp1250_general_ci",
+	"cp1251":   "cp1251_general_ci",
+	"cp1256":   "cp1256_general_ci",
+	"cp1257":   "cp1257_general_ci",
+	"cp850":    "cp850_general_ci",
+	"cp852":    "cp852_general_ci",
+	"cp866":    "cp866_general_ci",
+	"cp932":    "cp932_japanese_ci",
+	"dec8":     "dec8_swedish_ci",
+	"eucjpms":  "eucjpms_japanese_ci",
+	"euckr":    "euckr_korean_ci",
+	"gb18030":  "gb18030_chinese_ci",
+	"gb2312":   "gb2312_chinese_ci",
+	"gbk":      "gbk_chinese_ci",
+	"geostd8":  "geostd8_general_ci",
+	"greek":    "greek_general_ci",
+	"hebrew":   "hebrew_general_ci",
+	"hp8":      "hp8_english_ci",
+	"keybcs2":  "keybcs2_general_ci",
+	"koi8r":    "koi8r_general_ci",
+	"koi8u":    "koi8u_general_ci",
+	"latin1":   "latin1_swedish_ci",
+	"latin2":   "latin2_general_ci",
+	"latin5":   "latin5_turkish_ci",
+	"latin7":   "latin7_general_ci",
+	"macce":    "macce_general_ci",
+	"macroman": "macroman_general_ci",
+	"sjis":     "sjis_japanese_ci",
+	"swe7":     "swe7_swedish_ci",
+	"tis620":   "tis620_thai_ci",
+	"ucs2":     "ucs2_general_ci",
+	"ujis":     "ujis_japanese_ci",
+	"utf16":    "utf16_general_ci",
+	"utf16le":  "utf16le_general_ci",
+	"utf32":    "utf32_general_ci",
+	"utf8":     "utf8_general_ci",
+	"utf8mb3":  "utf8mb3_general_ci",
+	"utf8mb4":  "utf8mb4_general_ci",
+}
+
+// collations besides the defaults, per character set.
+var charsetCollations = map[string][]string{
+	"ascii":   {"ascii_bin"},
+	"big5":    {"big5_bin"},
+	"cp1250":  {"cp1250_bin", "cp1250_croatian_ci", "cp1250_czech_cs", "cp1250_polish_ci"},
+	"cp1251":  {"cp1251_bin", "cp1251_bulgarian_ci", "cp1251_general_cs", "cp1251_ukrainian_ci"},
+	"gb18030": {"gb18030_bin", "gb18030_unicode_520_ci"},
+	"gb2312":  {"gb2312_bin"},
+	"gbk":     {"gbk_bin"},
+	"latin1":  {"latin1_bin", "latin1_danish_ci", "latin1_general_ci", "latin1_general_cs", "latin1_german1_ci", "latin1_german2_ci", "latin1_spanish_ci"},
+	"latin2":  {"latin2_bin", "latin2_croatian_ci", "latin2_czech_cs", "latin2_hungarian_ci"},
+	"ucs2":    {"ucs2_bin", "ucs2_unicode_ci", "ucs2_unicode_520_ci"},
+	"utf16":   {"utf16_bin", "utf16_unicode_ci", "utf16_unicode_520_ci"},
+	"utf32":   {"utf32_bin", "utf32_unicode_ci", "utf32_unicode_520_ci"},
+	"utf8":    {"utf8_bin", "utf8_unicode_ci", "utf8_unicode_520_ci", "utf8_general_mysql500_ci"},
+	"utf8mb3": {"utf8mb3_bin", "utf8mb3_unicode_ci", "utf8mb3_unicode_520_ci", "utf8mb3_general_mysql500_ci"},
+	"utf8mb4": {
+		"utf8mb4_bin", "utf8mb4_unicode_ci", "utf8mb4_unicode_520_ci",
+		"utf8mb4_0900_ai_ci", "utf8mb4_0900_as_ci", "utf8mb4_0900_as_cs", "utf8mb4_0900_bin",
+		"utf8mb4_zh_0900_as_cs", "utf8mb4_ja_0900_as_cs", "utf8mb4_de_pb_0900_ai_ci",
+	},
+}
+
+// character set of a known collation.
+func collationCharset(collation string) (string, bool) {
+	for charset, def := range charsetDefaultCollation {
+		if def == collation {
+			return charset, true
+		}
+	}
+	for charset, collations := range charsetCollations {
+		for _, c := range collations {
+			if c == collation {
+				return charset, true
+			}
+		}
+	}
+	return "", false
+}
+
+// check charset and collation against the built-in table. either may be empty.
+// returns the character set to use, derived from the collation when charset is empty.
+func checkCharset(charset string, collation string) (string, error) {
+	charset = strings.ToLower(charset)
+	collation = strings.ToLower(collation)
+
+	if len(charset) > 0 {
+		if _, ok := charsetDefaultCollation[charset]; !ok {
+			return "", errors.NotValidf("character set %q", charset)
+		}
+	}
+	if len(collation) == 0 {
+		return charset, nil
+	}
+
+	collationSet, ok := collationCharset(collation)
+	if !ok {
+		return "", errors.NotValidf("collation %q", collation)
+	}
+	if len(charset) > 0 && charset != collationSet {
+		return "", errors.NewNotValid(nil, "collation "+collation+" does not belong to character set "+charset)
+	}
+	return collationSet, nil
+}
@@ -0,0 +1,158 @@
+package mydumper
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+)
+
+func TestCheckCharset(t *testing.T) {
+
+	cases := []struct {
+		charset   string
+		collation string
+		expected  string
+		valid     bool
+	}{
+		{"utf8mb4", "", "utf8mb4", true},
+		{"UTF8MB4", "utf8mb4_0900_ai_ci", "utf8mb4", true},
+		{"", "latin1_swedish_ci", "latin1", true},
+		{"", "", "", true},
+		{"utf8mb5", "", "", false},
+		{"utf8", "utf8mb4_bin", "", false},
+		{"", "utf8mb4_klingon_ci", "", false},
+	}
+
+	for _, c := range cases {
+		charset, err := checkCharset(c.charset, c.collation)
+		if (err == nil) != c.valid || charset != c.expected {
+			t.Errorf("%q/%q: got %q, %v", c.charset, c.collation, charset, err)
+		}
+	}
+}
+
+func TestCharsetRoundTrip(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper := newFakeDumperVersion(t, dir, "0.12.0",
+		"printf 'Started dump at: 2019-01-01 10:00:00\\nFinished dump at: 2019-01-01 10:00:01\\n' > "+dir+"/metadata")
+	dumper.SetOutPutDir(dir)
+	dumper.SetCharacterSet("utf8mb4")
+	dumper.SetCollation("utf8mb4_bin")
+
+	args, err := dumper.BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(args, " "), "--set-names utf8mb4") {
+		t.Errorf("--set-names missing in %v", args)
+	}
+
+	if err := dumper.Dump(); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := NewMeta(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := meta.ReadMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Charset != "utf8mb4" || meta.Collation != "utf8mb4_bin" {
+		t.Errorf("unexpected charset %q, collation %q", meta.Charset, meta.Collation)
+	}
+
+	loader := newFakeLoaderVersion(t, dir, "0.12.0", "")
+	loader.SetSourceDirectory(dir)
+
+	args, err = loader.BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(strings.Join(args, " "), "--set-names utf8mb4") {
+		t.Errorf("recorded charset not used by loader: %v", args)
+	}
+}
+
+func TestCharsetUnsupported(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper := newFakeDumperVersion(t, dir, "0.10.0", "")
+	dumper.SetCharacterSet("utf8mb4")
+
+	if _, err := dumper.BuildArgs(); !errors.IsNotSupported(err) {
+		t.Errorf("expected not supported error, got %v", err)
+	}
+}
+
+func TestCollationSessionVariable(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	// keeps the defaults file, writes no metadata.
+	dumper := newFakeDumperVersion(t, dir, "0.13.0", "cp \"$2\" "+dir+"/defaults")
+	dumper.SetOutPutDir(dir + "/backup")
+	dumper.SetCollation("utf8mb4_bin")
+
+	warnings := make([]string, 0)
+	dumper.SetEventHandler(EventHandlerFunc(func(e Event) {
+		if e.Level == LevelWarning {
+			warnings = append(warnings, e.Message)
+		}
+	}))
+
+	if err := dumper.Dump(); err != nil {
+		t.Fatalf("dump failed on the charset record: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "character set") {
+		t.Errorf("expected a warning about the charset record, got %q", warnings)
+	}
+
+	defaults, err := ioutil.ReadFile(dir + "/defaults")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(defaults), "[mydumper_session_variables]\ncollation_connection = \"utf8mb4_bin\"\n") {
+		t.Errorf("collation missing in defaults file:\n%s", defaults)
+	}
+}
+
+func TestLoaderRecordedCharsetWarning(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	meta := "Started dump at: 2019-01-01 10:00:00\nCharacter set: klingon\nFinished dump at: 2019-01-01 10:00:01\n"
+	if err := ioutil.WriteFile(dir+"/metadata", []byte(meta), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loader := newFakeLoaderVersion(t, dir, "0.12.0", "")
+	loader.SetSourceDirectory(dir)
+	var warning string
+	loader.SetEventHandler(EventHandlerFunc(func(e Event) {
+		if e.Level == LevelWarning {
+			warning = e.Message
+		}
+	}))
+
+	args, err := loader.BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(strings.Join(args, " "), "--set-names") {
+		t.Errorf("invalid recorded charset used: %v", args)
+	}
+	if !strings.Contains(warning, "klingon") {
+		t.Errorf("expected a warning about the recorded charset, got %q", warning)
+	}
+}
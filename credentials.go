@@ -0,0 +1,97 @@
+package mydumper
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// how the password reaches mydumper/myloader without appearing in argv.
+type credentials struct {
+	// prepended to the arguments.
+	args []string
+	// added to the environment.
+	env []string
+	// defaults file to remove after the process exits.
+	file string
+}
+
+// pass the password with --defaults-file when supported, otherwise MYSQL_PWD.
+func newCredentials(c Capabilities, password string) (*credentials, error) {
+	if c.Known && !c.DefaultsFile {
+		return newEnvCredentials(password), nil
+	}
+	return newDefaultsFileCredentials(password)
+}
+
+// write password into a temporary 0600 defaults file passed with --defaults-file.
+func newDefaultsFileCredentials(password string) (*credentials, error) {
+	fd, err := ioutil.TempFile("", "go-mydumper-")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer fd.Close()
+
+	c := &credentials{file: fd.Name()}
+	if err := fd.Chmod(0600); err != nil {
+		c.remove()
+		return nil, errors.Trace(err)
+	}
+	if _, err := fmt.Fprintf(fd, "[client]\npassword=\"%s\"\n", escapeOption(password)); err != nil {
+		c.remove()
+		return nil, errors.Trace(err)
+	}
+
+	c.args = []string{"--defaults-file", c.file}
+	return c, nil
+}
+
+// pass password through MYSQL_PWD, read by libmysqlclient.
+func newEnvCredentials(password string) *credentials {
+	return &credentials{env: []string{"MYSQL_PWD=" + password}}
+}
+
+// set session variables of tool, mydumper or myloader, in the defaults file.
+// the tool must support them, see Capabilities.SessionVariables.
+func (c *credentials) setSessionVariables(tool string, vars map[string]string) error {
+	if len(c.file) == 0 {
+		return errors.NotSupportedf("session variables without a defaults file")
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	section := fmt.Sprintf("[%s_session_variables]\n", tool)
+	for _, name := range names {
+		section += fmt.Sprintf("%s = \"%s\"\n", name, escapeOption(vars[name]))
+	}
+
+	fd, err := os.OpenFile(c.file, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer fd.Close()
+
+	_, err = fd.WriteString(section)
+	return errors.Trace(err)
+}
+
+// remove the defaults file, if any.
+func (c *credentials) remove() {
+	if len(c.file) > 0 {
+		os.Remove(c.file)
+	}
+}
+
+// escape a value for a double quoted option file value.
+func escapeOption(value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return r.Replace(value)
+}
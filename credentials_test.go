@@ -0,0 +1,82 @@
+package mydumper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const secret = "s3cr\"et\\pw"
+
+func TestPasswordNotInArgs(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper, err := NewDumper(fakeBinary(t, dir, "mydumper", ""), "127.0.0.1", 3306, "root", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, err := dumper.BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(strings.Join(args, " "), secret) {
+		t.Errorf("password in mydumper arguments: %v", args)
+	}
+
+	loader, err := NewLoader(fakeBinary(t, dir, "myloader", ""), "127.0.0.1", 3306, "root", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, err = loader.BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(strings.Join(args, " "), secret) {
+		t.Errorf("password in myloader arguments: %v", args)
+	}
+}
+
+func TestDefaultsFileCredentials(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	// record argv, the defaults file and its mode.
+	bin := fakeBinary(t, dir, "mydumper",
+		"echo \"$@\" > "+dir+"/argv; cat \"$2\" > "+dir+"/defaults; stat -c %a \"$2\" > "+dir+"/mode; echo \"$2\" > "+dir+"/path")
+
+	dumper, err := NewDumper(bin, "127.0.0.1", 3306, "root", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dumper.SetOutPutDir(filepath.Join(dir, "backup"))
+
+	if err := dumper.Dump(); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(name string) string {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.TrimSpace(string(data))
+	}
+
+	if argv := read("argv"); strings.Contains(argv, secret) || !strings.HasPrefix(argv, "--defaults-file ") {
+		t.Errorf("unexpected argv %q", argv)
+	}
+	if defaults := read("defaults"); defaults != "[client]\npassword=\"s3cr\\\"et\\\\pw\"" {
+		t.Errorf("unexpected defaults file %q", defaults)
+	}
+	if mode := read("mode"); mode != "600" {
+		t.Errorf("defaults file mode %s", mode)
+	}
+	if _, err := os.Stat(read("path")); !os.IsNotExist(err) {
+		t.Errorf("defaults file not removed")
+	}
+}
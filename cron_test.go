@@ -0,0 +1,55 @@
+package mydumper
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+	for _, expr := range []string{"* * * * *", "0,30 2-4 1 jan-mar MON-fri", "*/15 * * * 7", "5/20 * * * *", "@daily", "@Weekly"} {
+		if _, err := ParseCron(expr); err != nil {
+			t.Errorf("%q: %s", expr, err)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+
+	// a wednesday.
+	from := time.Date(2019, 1, 16, 10, 17, 30, 0, time.UTC)
+
+	cases := map[string]time.Time{
+		"* * * * *":       time.Date(2019, 1, 16, 10, 18, 0, 0, time.UTC),
+		"*/15 * * * *":    time.Date(2019, 1, 16, 10, 30, 0, 0, time.UTC),
+		"5/20 * * * *":    time.Date(2019, 1, 16, 10, 25, 0, 0, time.UTC),
+		"30 2 * * *":      time.Date(2019, 1, 17, 2, 30, 0, 0, time.UTC),
+		"0 0 * * 0":       time.Date(2019, 1, 20, 0, 0, 0, 0, time.UTC),
+		"0 0 * * 7":       time.Date(2019, 1, 20, 0, 0, 0, 0, time.UTC),
+		"0 3 * * mon-fri": time.Date(2019, 1, 17, 3, 0, 0, 0, time.UTC),
+		"@monthly":        time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":      time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		// either day field matches when both are restricted.
+		"0 0 1 * 5": time.Date(2019, 1, 18, 0, 0, 0, 0, time.UTC),
+	}
+
+	for expr, expected := range cases {
+		s, err := ParseCron(expr)
+		if err != nil {
+			t.Fatalf("%q: %s", expr, err)
+		}
+		if next := s.Next(from); !next.Equal(expected) {
+			t.Errorf("%q: expected %s, got %s", expr, expected, next)
+		}
+	}
+
+	never, _ := ParseCron("0 0 30 2 *")
+	if next := never.Next(from); !next.IsZero() {
+		t.Errorf("expected no run, got %s", next)
+	}
+}
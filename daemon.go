@@ -0,0 +1,326 @@
+package mydumper
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// directories mydumper alternates between in daemon mode.
+var daemonSnapshotDirs = []string{"0", "1"}
+
+const (
+	// interval between scans of the snapshot directories.
+	daemonPollInterval = time.Second
+	// delay before restarting a crashed daemon when RestartDelay is not set.
+	daemonRestartDelay = time.Second
+	// longest delay before restarting a crashed daemon.
+	daemonMaxRestartDelay = 5 * time.Minute
+	// how long Stop waits for the daemon to exit before killing it.
+	daemonStopTimeout = 10 * time.Second
+)
+
+// a mydumper daemon started by StartDaemon.
+type DaemonHandle struct {
+	dumper *Dumper
+	outdir string
+	events *eventDispatcher
+
+	stopOnce sync.Once
+	// closed by Stop.
+	stop chan struct{}
+	// closed once the daemon exited for good.
+	exited chan struct{}
+	// closed once the supervisor and the watcher returned.
+	done chan struct{}
+
+	mu        sync.Mutex
+	restarts  int
+	snapshots int
+	last      *MetaData
+	lastCrash error
+	// result of Wait.
+	err error
+	// metadata file of each snapshot directory at the last scan.
+	seen map[string]os.FileInfo
+}
+
+// start mydumper in daemon mode and supervise it. Daemon must be enabled and
+// Layout must be LayoutFlat. every snapshot mydumper completes in the 0 and 1
+// directories of OutPutDir is sent to EventHandler as an EventSnapshot with
+// its metadata. a crashed daemon is restarted after RestartDelay.
+// OutPutDir stays locked until the daemon is stopped with Stop or by ctx,
+// snapshots are not recorded in Catalog.
+func (d *Dumper) StartDaemon(ctx context.Context) (*DaemonHandle, error) {
+	if !d.Daemon {
+		return nil, errors.NotValidf("daemon mode disabled, see SetDaemon")
+	}
+	if d.Layout == LayoutPerRun {
+		return nil, errors.NotSupportedf("layout %s in daemon mode", d.Layout)
+	}
+	if d.DryRun {
+		return nil, errors.NotSupportedf("dry run in daemon mode")
+	}
+
+	args, err := d.BuildArgs()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	lock, err := lockDir(ctx, d.OutPutDir, d.LockTimeout)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	creds, err := d.credentials()
+	if err != nil {
+		lock.unlock()
+		return nil, errors.Trace(err)
+	}
+	args = append(creds.args, args...)
+
+	h := &DaemonHandle{
+		dumper: d,
+		outdir: d.OutPutDir,
+		events: newEventDispatcher(d.EventHandler),
+		stop:   make(chan struct{}),
+		exited: make(chan struct{}),
+		done:   make(chan struct{}),
+		seen:   make(map[string]os.FileInfo),
+	}
+	// snapshots of an earlier daemon are not reported.
+	for _, name := range daemonSnapshotDirs {
+		if info, err := os.Stat(filepath.Join(h.outdir, name, "metadata")); err == nil {
+			h.seen[name] = info
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer close(h.exited)
+		defer lock.unlock()
+		defer creds.remove()
+		h.supervise(ctx, args, creds.env)
+	}()
+	go func() {
+		defer wg.Done()
+		h.watch()
+	}()
+	go func() {
+		wg.Wait()
+		close(h.done)
+	}()
+	return h, nil
+}
+
+// run the daemon until it is stopped, restarting it when it exits.
+func (h *DaemonHandle) supervise(ctx context.Context, args []string, env []string) {
+	d := h.dumper
+	// an unset delay would fork a crashing daemon in a loop.
+	initial := d.RestartDelay
+	if initial <= 0 {
+		initial = daemonRestartDelay
+	}
+	delay := initial
+
+	for {
+		h.mu.Lock()
+		snapshots := h.snapshots
+		h.mu.Unlock()
+
+		p, err := startProcess(d.ExecutionPath, args, env, h.events)
+		if err == nil {
+			err = h.wait(ctx, p)
+		}
+
+		select {
+		case <-h.stop:
+			h.setErr(nil)
+			return
+		case <-ctx.Done():
+			h.setErr(errors.Annotatef(ErrCancelled, "%s", ctx.Err()))
+			return
+		default:
+		}
+
+		if err == nil {
+			err = errors.New("daemon exited")
+		}
+		h.mu.Lock()
+		h.restarts++
+		h.lastCrash = err
+		if h.snapshots > snapshots {
+			delay = initial
+		}
+		h.mu.Unlock()
+
+		h.events.send(Event{
+			Kind:    EventLog,
+			Time:    time.Now(),
+			Level:   LevelWarning,
+			Thread:  -1,
+			Message: fmt.Sprintf("mydumper daemon exited: %s, restarting in %s", errors.Cause(err), delay),
+		})
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-h.stop:
+			timer.Stop()
+			h.setErr(nil)
+			return
+		case <-ctx.Done():
+			timer.Stop()
+			h.setErr(errors.Annotatef(ErrCancelled, "%s", ctx.Err()))
+			return
+		case <-timer.C:
+		}
+
+		if delay *= 2; delay > daemonMaxRestartDelay {
+			delay = daemonMaxRestartDelay
+		}
+	}
+}
+
+// wait for the daemon to exit. Stop asks it to exit and kills it after
+// daemonStopTimeout, ctx kills it at once.
+func (h *DaemonHandle) wait(ctx context.Context, p *process) error {
+	select {
+	case err := <-p.done:
+		return errors.Trace(p.exitError(err))
+	case <-ctx.Done():
+		killProcessGroup(p.cmd)
+		<-p.done
+		return errors.Annotatef(ErrCancelled, "%s", ctx.Err())
+	case <-h.stop:
+		terminateProcessGroup(p.cmd)
+		timer := time.NewTimer(daemonStopTimeout)
+		defer timer.Stop()
+		select {
+		case <-p.done:
+		case <-timer.C:
+			killProcessGroup(p.cmd)
+			<-p.done
+		}
+		return nil
+	}
+}
+
+// scan the snapshot directories until the daemon exited for good, and once
+// more after that.
+func (h *DaemonHandle) watch() {
+	ticker := time.NewTicker(daemonPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.exited:
+			h.scan()
+			return
+		case <-ticker.C:
+			h.scan()
+		}
+	}
+}
+
+// report the snapshots completed since the last scan.
+func (h *DaemonHandle) scan() {
+	for _, name := range daemonSnapshotDirs {
+		dir := filepath.Join(h.outdir, name)
+		info, err := os.Stat(filepath.Join(dir, "metadata"))
+		if err != nil {
+			continue
+		}
+
+		h.mu.Lock()
+		prev := h.seen[name]
+		h.mu.Unlock()
+		if prev != nil && prev.ModTime().Equal(info.ModTime()) && prev.Size() == info.Size() {
+			continue
+		}
+
+		meta, err := NewMeta(dir)
+		if err != nil {
+			continue
+		}
+		// still being written by an older mydumper.
+		if err := meta.ReadMetadata(); err != nil || !meta.Completed {
+			continue
+		}
+
+		h.mu.Lock()
+		h.seen[name] = info
+		h.snapshots++
+		h.last = meta
+		h.mu.Unlock()
+
+		h.events.send(Event{
+			Kind:     EventSnapshot,
+			Time:     time.Now(),
+			Level:    LevelInfo,
+			Thread:   -1,
+			Message:  fmt.Sprintf("snapshot completed in %s", dir),
+			Snapshot: meta,
+		})
+	}
+}
+
+func (h *DaemonHandle) setErr(err error) {
+	h.mu.Lock()
+	h.err = err
+	h.mu.Unlock()
+}
+
+// stop the daemon and wait for it. mydumper is asked to exit and killed
+// when it does not within 10 seconds.
+func (h *DaemonHandle) Stop() error {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+	})
+	return h.Wait()
+}
+
+// wait until the daemon is stopped. the error satisfies IsCancelled when it
+// was stopped by the context passed to StartDaemon, it is nil after Stop.
+func (h *DaemonHandle) Wait() error {
+	<-h.done
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return errors.Trace(h.err)
+}
+
+// closed once the daemon is stopped.
+func (h *DaemonHandle) Done() <-chan struct{} {
+	return h.done
+}
+
+// number of times the daemon was restarted after a crash.
+func (h *DaemonHandle) Restarts() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.restarts
+}
+
+// error of the last crash, nil when the daemon did not crash.
+func (h *DaemonHandle) LastError() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lastCrash
+}
+
+// metadata of the last completed snapshot.
+func (h *DaemonHandle) LastSnapshot() (*MetaData, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.last == nil {
+		return nil, errors.NotFoundf("snapshot")
+	}
+	return h.last, nil
+}
@@ -0,0 +1,146 @@
+package mydumper
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// fake daemon writing one completed snapshot to <outputdir>/0, then sleeping.
+const fakeDaemon = `while [ $# -gt 0 ]; do if [ "$1" = "--outputdir" ]; then out="$2"; fi; shift; done
+mkdir -p "$out/0"
+printf 'Started dump at: 2019-01-01 10:00:00\nSHOW MASTER STATUS:\n\tLog: mysql-bin.000003\n\tPos: 154\n\tGTID:\n\n' > "$out/0/metadata.partial"
+printf 'Finished dump at: 2019-01-01 10:05:00\n' >> "$out/0/metadata.partial"
+mv "$out/0/metadata.partial" "$out/0/metadata"
+sleep 30`
+
+func newTestDaemon(t *testing.T, dir string, body string) (*Dumper, chan Event) {
+	dumper := newFakeDumper(t, dir, body)
+	dumper.SetOutPutDir(filepath.Join(dir, "backup"))
+	dumper.SetDaemon(true)
+	dumper.SetRestartDelay(10 * time.Millisecond)
+
+	events := make(chan Event, 100)
+	dumper.SetEventHandler(EventHandlerFunc(func(e Event) {
+		events <- e
+	}))
+	return dumper, events
+}
+
+func TestDaemonSnapshot(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper, events := newTestDaemon(t, dir, fakeDaemon)
+	h, err := dumper.StartDaemon(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	var snapshot *MetaData
+	for snapshot == nil {
+		select {
+		case e := <-events:
+			if e.Kind == EventSnapshot {
+				snapshot = e.Snapshot
+			}
+		case <-timeout:
+			h.Stop()
+			t.Fatal("no snapshot event")
+		}
+	}
+	if snapshot.MetaDir != filepath.Join(dir, "backup", "0") || snapshot.BinLogFileName != "mysql-bin.000003" || snapshot.BinLogFilePos != 154 {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+	if last, err := h.LastSnapshot(); err != nil || last != snapshot {
+		t.Errorf("unexpected last snapshot %v, %v", last, err)
+	}
+
+	if _, err := dumper.StartDaemon(context.Background()); !IsDirectoryLocked(err) {
+		t.Errorf("expected locked directory, got %v", err)
+	}
+
+	if err := h.Stop(); err != nil {
+		t.Error(err)
+	}
+	if h.Restarts() != 0 || h.LastError() != nil {
+		t.Errorf("unexpected restarts %d: %v", h.Restarts(), h.LastError())
+	}
+}
+
+func TestDaemonRestart(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper, _ := newTestDaemon(t, dir, "echo '** (mydumper:42): CRITICAL **: connection lost' >&2; exit 1")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h, err := dumper.StartDaemon(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for h.Restarts() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if h.Restarts() < 3 {
+		t.Errorf("expected restarts, got %d", h.Restarts())
+	}
+	if _, ok := errors.Cause(h.LastError()).(*ExecError); !ok {
+		t.Errorf("expected exec error, got %v", h.LastError())
+	}
+
+	cancel()
+	if err := h.Wait(); !IsCancelled(err) {
+		t.Errorf("expected cancelled, got %v", err)
+	}
+	if _, err := h.LastSnapshot(); !errors.IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+}
+
+func TestDaemonRestartDelayUnset(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper, _ := newTestDaemon(t, dir, "exit 1")
+	dumper.SetRestartDelay(0)
+	h, err := dumper.StartDaemon(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	if restarts := h.Restarts(); restarts > 1 {
+		t.Errorf("daemon restarted %d times without delay", restarts)
+	}
+	if err := h.Stop(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDaemonMode(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper, _ := newTestDaemon(t, dir, "")
+	if err := dumper.Dump(); !errors.IsNotSupported(err) {
+		t.Errorf("expected not supported, got %v", err)
+	}
+
+	dumper.SetDaemon(false)
+	if _, err := dumper.StartDaemon(context.Background()); !errors.IsNotValid(err) {
+		t.Errorf("expected not valid, got %v", err)
+	}
+}
@@ -5,20 +5,53 @@ import "time"
 // record operations into sqlite.
 type (
 	Recorder struct {
-		Id             uint64    `json:"id" db:"id"`
-		Type           uint64    `json:"type" db:"type"`
-		Method         uint64    `json:"method" db:"method"`
-		State          uint64    `json:"state" db:"state"`
-		BackupDir      string    `json:"backup_dir" db:"backup_dir"`
-		BinLogFileName string    `json:"binlog_filename" db:"binlog_filename"`
-		BinLogFilePos  uint64    `json:"binlog_filepos" db:"binlog_filepos"`
-		BinLogUuid     string    `json:"binlog_uuid" db:"binlog_uuid"`
-		StartTimestamp time.Time `json:"start_timestamp" db:"start_timestamp"`
-		EndTimestamp   time.Time `json:"end_timestamp" db:"end_timestamp"`
+		Id   uint64     `json:"id" db:"id"`
+		Type BackupType `json:"type" db:"type"`
+		// OperationRestore for a restore of BackupDir.
+		Operation      Operation    `json:"operation" db:"operation"`
+		Method         BackupMethod `json:"method" db:"method"`
+		State          BackupState  `json:"state" db:"state"`
+		BackupDir      string       `json:"backup_dir" db:"backup_dir"`
+		BinLogFileName string       `json:"binlog_filename" db:"binlog_filename"`
+		BinLogFilePos  uint64       `json:"binlog_filepos" db:"binlog_filepos"`
+		BinLogUuid     string       `json:"binlog_uuid" db:"binlog_uuid"`
+		StartTimestamp time.Time    `json:"start_timestamp" db:"start_timestamp"`
+		EndTimestamp   time.Time    `json:"end_timestamp" db:"end_timestamp"`
+		// error text of a failed or cancelled run.
+		Message string `json:"message" db:"message"`
+		// bytes in BackupDir after the run.
+		Size uint64 `json:"size" db:"size"`
+		// sha256 of manifest.json, empty without a manifest. it identifies
+		// the manifest, which records a creation time, not the dumped data.
+		Checksum string `json:"checksum" db:"checksum"`
+		// server_uuid of the dumped server.
+		ServerUuid string `json:"server_uuid" db:"server_uuid"`
+		// version of mydumper/myloader that made the run.
+		MydumperVersion string `json:"mydumper_version" db:"mydumper_version"`
+		// free form key/value pairs, stored as JSON.
+		Labels Labels `json:"labels" db:"labels"`
 	}
 )
 
 const (
+	// applied versions of the catalog schema, see migrations.
+	StmtSchemaVersion = `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version integer NOT NULL,
+		checksum varchar(64) NOT NULL,
+		applied_at datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (version)
+	)
+	`
+	StmtQuerySchemaVersion = `
+	SELECT version,checksum FROM schema_version ORDER BY version
+	`
+	StmtInsertSchemaVersion = `
+	INSERT INTO schema_version(version,checksum,applied_at) VALUES (?,?,?)
+	`
+
+	// migration 1, the schema of the first catalogs, which had no
+	// schema_version table. never change it.
 	StmtSchema = `
 	CREATE TABLE IF NOT EXISTS t_data_backup (
 		id integer NOT NULL,
@@ -31,34 +64,64 @@ const (
 		binlog_uuid varchar(512),
 		start_timestamp datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		end_timestamp datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		PRIMARY KEY ('id')
-	)
+		PRIMARY KEY (id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_data_backup_state ON t_data_backup (state);
+	CREATE INDEX IF NOT EXISTS idx_data_backup_start ON t_data_backup (start_timestamp);
+	`
+	// migration 2.
+	StmtSchemaV2 = `
+	ALTER TABLE t_data_backup ADD COLUMN message text NOT NULL DEFAULT '';
+	`
+	// migration 3.
+	StmtSchemaV3 = `
+	ALTER TABLE t_data_backup ADD COLUMN size integer NOT NULL DEFAULT 0;
+	ALTER TABLE t_data_backup ADD COLUMN checksum varchar(128) NOT NULL DEFAULT '';
+	ALTER TABLE t_data_backup ADD COLUMN server_uuid varchar(64) NOT NULL DEFAULT '';
+	ALTER TABLE t_data_backup ADD COLUMN mydumper_version varchar(32) NOT NULL DEFAULT '';
+	ALTER TABLE t_data_backup ADD COLUMN labels text NOT NULL DEFAULT '{}';
+	`
+	// migration 4.
+	StmtSchemaV4 = `
+	ALTER TABLE t_data_backup ADD COLUMN operation int NOT NULL DEFAULT 0;
 	`
 	StmtInsertRecord = `
 	INSERT INTO 
-		t_data_backup(id,type,method,state,backup_dir,binlog_filename,binlog_filepos,binlog_uuid,start_timestamp,end_timestamp)
-	VALUE
-		(%d,%d,%d,%d,'%s','%s',%d,'%s','%s','%s')
+		t_data_backup(type,method,state,backup_dir,binlog_filename,binlog_filepos,binlog_uuid,start_timestamp,end_timestamp,message,
+		size,checksum,server_uuid,mydumper_version,labels,operation)
+	VALUES
+		(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
 	`
 	StmtDeleteRecord = `
-	DELETE FROM t_data_backup WHERE id = %d
+	DELETE FROM t_data_backup WHERE id = ?
 	`
 	StmtUpdateRecord = `
 	UPDATE t_data_backup SET 
-		type = %d,
-		method = %d,
-		state = %d,
-		backup_dir = '%s',
-		binlog_filename = '%s',
-		binlog_filepos = %d,
-		binlog_uuid = '%s',
-		start_timestamp = '%s',
-		end_timestamp = '%s'
-	WHERE id = %d
+		type = ?,
+		method = ?,
+		state = ?,
+		backup_dir = ?,
+		binlog_filename = ?,
+		binlog_filepos = ?,
+		binlog_uuid = ?,
+		start_timestamp = ?,
+		end_timestamp = ?,
+		message = ?,
+		size = ?,
+		checksum = ?,
+		server_uuid = ?,
+		mydumper_version = ?,
+		labels = ?,
+		operation = ?
+	WHERE id = ?
+	`
+	StmtQueryRecordState = `
+	SELECT state FROM t_data_backup WHERE id = ?
 	`
 	StmtQueryRecord = `
 	SELECT 
-		id,type,method,state,backup_dir,binlog_filename,binlog_filepos,binlog_uuid,start_timestamp,end_timestamp
+		id,type,method,state,backup_dir,binlog_filename,binlog_filepos,binlog_uuid,start_timestamp,end_timestamp,message,
+		size,checksum,server_uuid,mydumper_version,labels,operation
 	FROM
 		t_data_backup
 	`
@@ -1,11 +1,17 @@
 package mydumper
 
 import (
-	"bytes"
+	"context"
+	"database/sql"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/juju/errors"
 )
@@ -14,13 +20,19 @@ type (
 	Dumper struct {
 		// mydumper path. default is /usr/bin/mydumper
 		ExecutionPath string `json:"execution_path" db:"execution_path"`
+		// detected mydumper version and the options it supports.
+		Version      Version      `json:"version" db:"-"`
+		Capabilities Capabilities `json:"capabilities" db:"-"`
 
 		// mysql database information.
 		Addr     string `json:"addr" db:"addr"`
 		Port     uint64 `json:"port" db:"port"`
 		User     string `json:"username" db:"username"`
 		Password string `json:"password" db:"password"`
-		// character default utf8,collation default is utf8_general_ci.
+		// session character set and collation, recorded in the metadata file.
+		// default is the server's. the character set is passed with --set-names,
+		// the collation as collation_connection where mydumper reads session
+		// variables from the defaults file.
 		Charset   string `json:"character" db:"character"`
 		Collation string `json:"collation" db:"collation"`
 
@@ -29,15 +41,23 @@ type (
 		Tables    []string `json:"tables" db:"tables"`
 
 		OutPutDir string `json:"output_dir" db:"output_dir"`
+		// LayoutFlat or LayoutPerRun. default LayoutFlat
+		Layout string `json:"layout" db:"layout"`
+		// how long to wait for another dump holding the lock of OutPutDir, or of
+		// the server's run directory in LayoutPerRun. 0 fails at once with
+		// ErrDirectoryLocked, negative waits until the context is done.
+		LockTimeout time.Duration `json:"lock_timeout" db:"lock_timeout"`
 		// Attempted size of INSERT statement in bytes.default  1000000
 		StatementSize uint64 `json:"statement_size" db:"statement_size"`
-		// Try to split tables into chunks of this many rows.
+		// Try to split tables into chunks of this many rows. 0 disables.
 		Rows uint64 `json:"rows" db:"rows"`
-		// Split tables into chunks of this output file size. unit is MB.
+		// Split tables into chunks of this output file size. unit is MB. 0 disables,
+		// cannot be used together with Rows. default 0, it was 64 before Validate
+		// rejected the combination, see README.
 		ChunkFilesize uint64 `json:"chunk_filesize" db:"chunk_filesize"`
 		// compress output files. default disable
 		Compress bool `json:"compress" db:"compress"`
-		// enable daemon mode.
+		// enable daemon mode, the daemon is started with StartDaemon.
 		Daemon bool `json:"daemon" db:"daemon"`
 		// Set long query timer in seconds. default 60
 		LongQueryGuard uint64 `json:"long_query_guard" db:"long_query_guard"`
@@ -45,6 +65,10 @@ type (
 		KillLongQueries bool `json:"kill_long_queries" db:"kill_long_queries"`
 		// Interval between each dump snapshot( in minutes).requires --daemon,default 60
 		SnapshotInterval uint64 `json:"snapshot_interval" db:"snapshot_interval"`
+		// delay before StartDaemon restarts a crashed daemon, doubled after every
+		// crash up to 5 minutes and reset by a completed snapshot. default 1s,
+		// also used when not positive.
+		RestartDelay time.Duration `json:"restart_delay" db:"restart_delay"`
 		// print messages to logfile.
 		LogFile string `json:"log_file" db:"log_file"`
 		// SET TIME_ZONE='+00:00'
@@ -87,6 +111,27 @@ type (
 
 		//Regular expression for 'db.table' matching
 		Regex string `json:"regex" db:"regex"`
+
+		// verbosity of output, 0 = silent, 1 = errors, 2 = warnings, 3 = info. default 2
+		Verbose uint64 `json:"verbose" db:"verbose"`
+		// receive the output lines of mydumper.
+		EventHandler EventHandler `json:"-" db:"-"`
+		// track progress of the dump, see Progress.
+		TrackProgress bool `json:"track_progress" db:"track_progress"`
+		// connection to the dumped server the expected table sizes are read
+		// from. nil connects with the ProgressDriver.
+		ProgressDB *sql.DB `json:"-" db:"-"`
+		// only report the command, do not execute mydumper.
+		DryRun bool `json:"dry_run" db:"dry_run"`
+		// write manifest.json with the checksum of every file, see Verify.
+		Manifest bool `json:"manifest" db:"manifest"`
+		// record every dump in the catalog, nil disables.
+		Catalog *Catalog `json:"-" db:"-"`
+
+		mu       sync.Mutex
+		progress *progressTracker
+		record   *Recorder
+		runDir   string
 	}
 )
 
@@ -101,8 +146,15 @@ func NewDumper(execution_path string, addr string, port uint64, user string, pas
 		return nil, errors.Trace(err)
 	}
 
+	version, capabilities, err := detectVersion(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	d := new(Dumper)
 	d.ExecutionPath = path
+	d.Version = version
+	d.Capabilities = capabilities
 	d.Addr = addr
 	d.Port = port
 	d.User = user
@@ -111,15 +163,17 @@ func NewDumper(execution_path string, addr string, port uint64, user string, pas
 	d.Databases = make([]string, 0, 16)
 	d.Tables = make([]string, 0, 16)
 	d.OutPutDir = "/backup"
+	d.Layout = LayoutFlat
 
 	d.StatementSize = 1000000
 	d.Rows = 1000000
-	d.ChunkFilesize = 64
+	d.ChunkFilesize = 0
 	d.Compress = true
 	d.Daemon = false
 	d.LongQueryGuard = 600
 	d.KillLongQueries = false
 	d.SnapshotInterval = 60
+	d.RestartDelay = time.Second
 	d.LogFile = "stdout"
 	d.UtcTimeZone = false
 	d.SkipUtcTimeZone = true
@@ -127,7 +181,7 @@ func NewDumper(execution_path string, addr string, port uint64, user string, pas
 	d.SuccessOn1146 = false
 	d.LockAllTables = false
 	d.UpdatedSince = false
-	d.TrxConsistencyOnly = true
+	d.TrxConsistencyOnly = !capabilities.Known || capabilities.TrxConsistencyOnly
 	d.CompleteInsert = true
 	d.Threads = uint64(runtime.NumCPU())
 	d.CompressProtocol = false
@@ -145,6 +199,8 @@ func NewDumper(execution_path string, addr string, port uint64, user string, pas
 
 	d.Regex = "^(?!(sys))"
 
+	d.Verbose = 2
+
 	return d, nil
 }
 
@@ -153,7 +209,7 @@ func (d *Dumper) AddDatabase(dbs ...string) {
 	d.Databases = append(d.Databases, dbs...)
 }
 
-// add tables to backup
+// add tables to backup, qualified as db.table
 func (d *Dumper) AddTables(tables ...string) error {
 	if len(d.Databases) > 0 {
 		d.Tables = append(d.Tables, tables...)
@@ -168,6 +224,24 @@ func (d *Dumper) SetOutPutDir(output_dir string) {
 	d.OutPutDir = output_dir
 }
 
+// set output directory layout
+func (d *Dumper) SetLayout(layout string) {
+	d.Layout = layout
+}
+
+// set how long to wait for the directory lock
+func (d *Dumper) SetLockTimeout(timeout time.Duration) {
+	d.LockTimeout = timeout
+}
+
+// directory of the running or last dump. in LayoutPerRun a failed run is
+// reported with its FailedRunSuffix name.
+func (d *Dumper) RunDir() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.runDir
+}
+
 // set character set.
 func (d *Dumper) SetCharacterSet(charset string) {
 	d.Charset = charset
@@ -218,6 +292,11 @@ func (d *Dumper) SetSnapshotInterval(interval uint64) {
 	d.SnapshotInterval = interval
 }
 
+// set restart delay of a crashed daemon
+func (d *Dumper) SetRestartDelay(delay time.Duration) {
+	d.RestartDelay = delay
+}
+
 // set log file.
 func (d *Dumper) SetLogFile(logfile string) {
 	d.LogFile = logfile
@@ -260,7 +339,7 @@ func (d *Dumper) SetTrxConsistencyOnly(trx_consistency_only bool) {
 
 // set Complete insert
 func (d *Dumper) SetCompleteInsert(complete_insert bool) {
-	d.TrxConsistencyOnly = complete_insert
+	d.CompleteInsert = complete_insert
 }
 
 // set threads
@@ -323,11 +402,268 @@ func (d *Dumper) SetRegex(regex string) {
 	d.Regex = regex
 }
 
-// execute dump
+// set verbosity
+func (d *Dumper) SetVerbose(verbose uint64) {
+	d.Verbose = verbose
+}
+
+// set event handler. verbose 3 is needed to receive per table messages.
+func (d *Dumper) SetEventHandler(handler EventHandler) {
+	d.EventHandler = handler
+}
+
+// enable/disable progress tracking
+func (d *Dumper) SetTrackProgress(enable bool) {
+	d.TrackProgress = enable
+}
+
+// set connection to read table sizes from
+func (d *Dumper) SetProgressDB(db *sql.DB) {
+	d.ProgressDB = db
+}
+
+// progress of the running or last dump. TrackProgress must be enabled.
+// tables are counted as finished from mydumper's messages, which needs verbose 3.
+func (d *Dumper) Progress() (Progress, error) {
+	d.mu.Lock()
+	tracker := d.progress
+	d.mu.Unlock()
+
+	if tracker == nil {
+		return Progress{}, errors.NotFoundf("progress")
+	}
+	return tracker.Progress(), nil
+}
+
+// enable/disable dry run
+func (d *Dumper) SetDryRun(enable bool) {
+	d.DryRun = enable
+}
+
+// enable/disable the checksum manifest
+func (d *Dumper) SetManifest(enable bool) {
+	d.Manifest = enable
+}
+
+// set catalog to record dumps in
+func (d *Dumper) SetCatalog(catalog *Catalog) {
+	d.Catalog = catalog
+}
+
+// catalog record of the running or last dump. Catalog must be set.
+func (d *Dumper) Record() (*Recorder, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.record == nil {
+		return nil, errors.NotFoundf("catalog record")
+	}
+	r := *d.record
+	return &r, nil
+}
+
+// the command Dump would execute, starting with the mydumper path.
+func (d *Dumper) Command() ([]string, error) {
+	args, err := d.BuildArgs()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return command(d.ExecutionPath, args, d.Capabilities), nil
+}
+
+// execute dump. the configuration is checked with Validate first.
 func (d *Dumper) Dump() error {
+	return d.DumpContext(context.Background())
+}
+
+// execute dump, killing mydumper when ctx is done.
+// the error satisfies IsCancelled when the dump was cancelled. after a
+// cancelled or failed dump the entries mydumper created in OutPutDir are removed,
+// in LayoutPerRun the run directory is kept and renamed with FailedRunSuffix.
+// the directory is locked for the dump, see LockTimeout.
+// with a Catalog the dump is recorded as running before mydumper starts and
+// as succeeded, failed or cancelled when it exits.
+func (d *Dumper) DumpContext(ctx context.Context) error {
+
+	now := time.Now()
+	perRun := d.Layout == LayoutPerRun
+	base := runBaseDir(d.OutPutDir, d.Addr, d.Port)
+
+	outdir := d.OutPutDir
+	if perRun {
+		outdir = filepath.Join(base, runID(now))
+	}
+
+	args, err := d.buildArgs(outdir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if d.DryRun {
+		dryRun(d.EventHandler, command(d.ExecutionPath, args, d.Capabilities))
+		return nil
+	}
+	// mydumper would never exit.
+	if d.Daemon {
+		return errors.NewNotSupported(nil, "dump in daemon mode, use StartDaemon")
+	}
+
+	lockdir := outdir
+	if perRun {
+		lockdir = base
+	}
+	lock, err := lockDir(ctx, lockdir, d.LockTimeout)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer lock.unlock()
+
+	if perRun {
+		if outdir, err = newRunDir(base, now); err != nil {
+			return errors.Trace(err)
+		}
+		if args, err = d.buildArgs(outdir); err != nil {
+			return errors.Trace(err)
+		}
+	}
+
+	record, err := startRecord(d.Catalog, OperationBackup, outdir, d.Version)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	d.mu.Lock()
+	d.record = record
+	d.runDir = outdir
+	d.mu.Unlock()
+
+	err = d.execute(ctx, args, outdir, !perRun)
+
+	// the run is complete without the link, it keeps its name and is
+	// recorded as succeeded, only LatestRun misses it.
+	if perRun && err == nil {
+		if lerr := switchLatest(base, outdir); lerr != nil {
+			newEventDispatcher(d.EventHandler).warn(fmt.Sprintf("cannot switch %s to %s: %s", LatestRunName, filepath.Base(outdir), lerr))
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if perRun && err != nil {
+		if failed, qerr := quarantineRun(outdir); qerr == nil {
+			outdir = failed
+			d.runDir = failed
+			if record != nil {
+				record.BackupDir = failed
+			}
+		}
+	}
+	return errors.Trace(finishRecord(d.Catalog, record, outdir, err))
+}
+
+// run mydumper writing to outdir. with cleanup the entries it created are
+// removed when it fails.
+func (d *Dumper) execute(ctx context.Context, args []string, outdir string, cleanup bool) error {
+	// the password goes into a defaults file or the environment, never into argv.
+	creds, err := d.credentials()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer creds.remove()
+	args = append(creds.args, args...)
+
+	existing, err := listDir(outdir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	handler := d.EventHandler
+	var tracker *progressTracker
+	if d.TrackProgress {
+		tracker = newProgressTracker(ctx, d, outdir, handler)
+		handler = tracker
+
+		d.mu.Lock()
+		d.progress = tracker
+		d.mu.Unlock()
+	}
+	events := newEventDispatcher(handler)
+
+	if tracker != nil {
+		tracker.start(events)
+	}
+	err = run(ctx, d.ExecutionPath, args, creds.env, events)
+	if tracker != nil {
+		tracker.finish(err == nil)
+	}
+	if err != nil {
+		if cleanup {
+			removeNewEntries(outdir, existing)
+		}
+		return errors.Trace(err)
+	}
+
+	// the dump is complete, a missing record only costs the loader its charset.
+	if len(d.Charset) > 0 || len(d.Collation) > 0 {
+		charset, _ := checkCharset(d.Charset, d.Collation)
+		collation := strings.ToLower(d.Collation)
+		if len(collation) == 0 {
+			collation = charsetDefaultCollation[charset]
+		}
+		if err := writeCharsetMetadata(outdir, charset, collation); err != nil {
+			events.warn(fmt.Sprintf("cannot record character set in metadata: %s", err))
+		}
+	}
+
+	// likewise a missing manifest, which Verify reports.
+	if d.Manifest {
+		if _, err := WriteManifest(outdir); err != nil {
+			events.warn(fmt.Sprintf("cannot write manifest: %s", err))
+		}
+	}
+	return nil
+}
 
-	var out bytes.Buffer
-	var stderr bytes.Buffer
+// password, and the collation where supported, for mydumper.
+func (d *Dumper) credentials() (*credentials, error) {
+	creds, err := newCredentials(d.Capabilities, d.Password)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(d.Collation) > 0 && d.Capabilities.SessionVariables {
+		vars := map[string]string{"collation_connection": strings.ToLower(d.Collation)}
+		if err := creds.setSessionVariables("mydumper", vars); err != nil {
+			creds.remove()
+			return nil, errors.Trace(err)
+		}
+	}
+	return creds, nil
+}
+
+// build mydumper arguments. the password is not part of them, it is passed
+// through a temporary defaults file when mydumper is executed.
+// in LayoutPerRun --outputdir is OutPutDir, a dump replaces it with the run directory.
+func (d *Dumper) BuildArgs() ([]string, error) {
+	return d.buildArgs(d.OutPutDir)
+}
+
+func (d *Dumper) buildArgs(outdir string) ([]string, error) {
+
+	if err := d.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	if err := d.checkCapabilities(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	charset, err := checkCharset(d.Charset, d.Collation)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(charset) > 0 && d.Capabilities.Known && !d.Capabilities.SetNames {
+		return nil, errors.NotSupportedf("--set-names by mydumper %s", d.Version)
+	}
 
 	// define arg
 	args := make([]string, 0, 61)
@@ -338,8 +674,6 @@ func (d *Dumper) Dump() error {
 	args = append(args, fmt.Sprintf("%d", d.Port))
 	args = append(args, fmt.Sprintf("--user"))
 	args = append(args, fmt.Sprintf("%s", d.User))
-	args = append(args, fmt.Sprintf("--password"))
-	args = append(args, fmt.Sprintf("%s", d.Password))
 
 	if len(d.Databases) > 0 {
 		args = append(args, fmt.Sprintf("--database"))
@@ -351,12 +685,8 @@ func (d *Dumper) Dump() error {
 		args = append(args, fmt.Sprintf("%s", strings.Join(d.Tables, ",")))
 	}
 
-	if len(d.OutPutDir) > 0 {
-		args = append(args, fmt.Sprintf("--outputdir"))
-		args = append(args, fmt.Sprintf("%s", d.OutPutDir))
-	} else {
-		return errors.NotFoundf("%s", d.OutPutDir)
-	}
+	args = append(args, fmt.Sprintf("--outputdir"))
+	args = append(args, fmt.Sprintf("%s", outdir))
 
 	if len(d.LogFile) > 0 {
 		if strings.Compare(d.LogFile, "stdout") != 0 {
@@ -365,12 +695,23 @@ func (d *Dumper) Dump() error {
 		}
 	}
 
+	if len(charset) > 0 {
+		args = append(args, fmt.Sprintf("--set-names"))
+		args = append(args, fmt.Sprintf("%s", charset))
+	}
+
 	args = append(args, fmt.Sprintf("--statement-size"))
 	args = append(args, fmt.Sprintf("%d", d.StatementSize))
-	args = append(args, fmt.Sprintf("--rows"))
-	args = append(args, fmt.Sprintf("%d", d.Rows))
-	args = append(args, fmt.Sprintf("--chunk-filesize"))
-	args = append(args, fmt.Sprintf("%d", d.ChunkFilesize))
+
+	if d.Rows > 0 {
+		args = append(args, fmt.Sprintf("--rows"))
+		args = append(args, fmt.Sprintf("%d", d.Rows))
+	}
+
+	if d.ChunkFilesize > 0 {
+		args = append(args, fmt.Sprintf("--chunk-filesize"))
+		args = append(args, fmt.Sprintf("%d", d.ChunkFilesize))
+	}
 
 	if d.Compress {
 		args = append(args, fmt.Sprintf("--compress"))
@@ -452,17 +793,55 @@ func (d *Dumper) Dump() error {
 		args = append(args, fmt.Sprintf("--no-views"))
 	}
 
+	if d.NoLock {
+		args = append(args, fmt.Sprintf("--no-locks"))
+	}
+
+	if d.NoBackupLock {
+		args = append(args, fmt.Sprintf("--no-backup-locks"))
+	}
+
+	if d.LessLock {
+		args = append(args, fmt.Sprintf("--less-locking"))
+	}
+
 	if len(d.Regex) > 0 {
 		args = append(args, fmt.Sprintf("--regex"))
 		args = append(args, fmt.Sprintf("%s", d.Regex))
 	}
 
-	cmd := exec.Command(d.ExecutionPath, args...)
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+	args = append(args, fmt.Sprintf("--verbose"))
+	args = append(args, fmt.Sprintf("%d", d.Verbose))
+
+	return args, nil
+}
+
+// list the entry names of dir. a missing dir has no entries.
+func listDir(dir string) (map[string]bool, error) {
+	names := make(map[string]bool)
+
+	infos, err := ioutil.ReadDir(dir)
 	if err != nil {
-		return errors.Trace(err)
+		if os.IsNotExist(err) {
+			return names, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	for _, info := range infos {
+		names[info.Name()] = true
+	}
+	return names, nil
+}
+
+// remove the entries of dir that are not in existing.
+func removeNewEntries(dir string, existing map[string]bool) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		if !existing[info.Name()] {
+			os.RemoveAll(filepath.Join(dir, info.Name()))
+		}
 	}
-	return nil
 }
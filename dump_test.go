@@ -1,8 +1,14 @@
 package mydumper
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDumpAllDatabases(t *testing.T) {
@@ -110,7 +116,7 @@ func TestDumpSomeTables(t *testing.T) {
 
 	dumper.SetOutPutDir("/backup")
 	dumper.AddDatabase("dev")
-	dumper.AddTables("t1", "t2", "t3")
+	dumper.AddTables("dev.t1", "dev.t2", "dev.t3")
 
 	err = dumper.Dump()
 	if err != nil {
@@ -133,3 +139,130 @@ func TestDumpSomeTables(t *testing.T) {
 	fmt.Println(meta.BinLogUuid)
 	fmt.Println(meta.EndTimestamp.String())
 }
+
+func TestDumpContextCancel(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	outdir := filepath.Join(dir, "backup")
+	if err := os.Mkdir(outdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(outdir, "keep.sql"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dumper := newFakeDumper(t, dir, "touch "+outdir+"/metadata.partial; sleep 30 & sleep 30")
+	dumper.SetOutPutDir(outdir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := dumper.DumpContext(ctx)
+	if !IsCancelled(err) {
+		t.Fatalf("expected cancelled error, got %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("dump was not killed on cancel")
+	}
+
+	if _, err := os.Stat(filepath.Join(outdir, "metadata.partial")); !os.IsNotExist(err) {
+		t.Errorf("partial metadata was not removed")
+	}
+	if _, err := os.Stat(filepath.Join(outdir, "keep.sql")); err != nil {
+		t.Errorf("existing file was removed: %v", err)
+	}
+}
+
+func TestDumpBuildArgs(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper := newFakeDumper(t, dir, "")
+	dumper.SetOutPutDir("/data/backup")
+	dumper.AddDatabase("dev")
+	dumper.SetThreads(8)
+
+	args, err := dumper.BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	joined := strings.Join(args, " ")
+	for _, expected := range []string{"--host 127.0.0.1", "--port 3306", "--user root", "--database dev", "--outputdir /data/backup", "--threads 8"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("missing %q in %q", expected, joined)
+		}
+	}
+
+	dumper.SetOutPutDir("")
+	if _, err := dumper.BuildArgs(); err == nil {
+		t.Errorf("expected error without output dir")
+	}
+}
+
+func TestDumpDryRun(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper := newFakeDumper(t, dir, "touch "+dir+"/executed")
+	dumper.SetOutPutDir(dir)
+	dumper.SetDryRun(true)
+
+	var message string
+	dumper.SetEventHandler(EventHandlerFunc(func(e Event) {
+		message = e.Message
+	}))
+
+	if err := dumper.Dump(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "executed")); !os.IsNotExist(err) {
+		t.Errorf("mydumper was executed in dry run")
+	}
+
+	cmd, err := dumper.Command()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd[0] != dumper.ExecutionPath || message != "dry run: "+strings.Join(cmd, " ") {
+		t.Errorf("unexpected command %v, message %q", cmd, message)
+	}
+}
+
+func TestDumpLockOptions(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper := newFakeDumper(t, dir, "")
+	dumper.SetTrxConsistencyOnly(false)
+	dumper.SetNoLock(true)
+	dumper.SetNoBasckupLock(true)
+
+	args, err := dumper.BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := strings.Join(args, " ")
+	if !strings.Contains(joined, "--no-locks") || !strings.Contains(joined, "--no-backup-locks") {
+		t.Errorf("lock options missing in %q", joined)
+	}
+
+	dumper.SetLockAllTables(true)
+	if _, err := dumper.BuildArgs(); err == nil {
+		t.Errorf("expected error for LockAllTables with NoLock")
+	}
+
+	dumper.SetLockAllTables(false)
+	dumper.SetNoLock(false)
+	dumper.SetLessLock(true)
+	dumper.SetTrxConsistencyOnly(true)
+	if _, err := dumper.BuildArgs(); err == nil {
+		t.Errorf("expected error for TrxConsistencyOnly with LessLock")
+	}
+}
@@ -0,0 +1,173 @@
+package mydumper
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// log levels of an Event.
+const (
+	LevelDebug    = "debug"
+	LevelInfo     = "info"
+	LevelMessage  = "message"
+	LevelWarning  = "warning"
+	LevelCritical = "critical"
+)
+
+// kinds of Event.
+const (
+	// a line of mydumper/myloader output.
+	EventLog = "log"
+	// a progress update, see Dumper.Progress.
+	EventProgress = "progress"
+	// a snapshot completed by mydumper in daemon mode, see Dumper.StartDaemon.
+	EventSnapshot = "snapshot"
+)
+
+type (
+	// one line of mydumper/myloader output, a progress update or a snapshot.
+	Event struct {
+		Kind  string    `json:"kind"`
+		Time  time.Time `json:"time"`
+		Level string    `json:"level"`
+		// thread number, -1 when the line is not about a thread.
+		Thread   int    `json:"thread"`
+		Database string `json:"database"`
+		Table    string `json:"table"`
+		Message  string `json:"message"`
+		// the line as printed by the binary.
+		Raw string `json:"raw"`
+		// set for EventProgress.
+		Progress *Progress `json:"progress,omitempty"`
+		// metadata of the snapshot, set for EventSnapshot.
+		Snapshot *MetaData `json:"snapshot,omitempty"`
+	}
+
+	// receive events while Dump or Load is running.
+	// HandleEvent is called from one goroutine at a time.
+	EventHandler interface {
+		HandleEvent(e Event)
+	}
+
+	// adapter to use a function as EventHandler.
+	EventHandlerFunc func(e Event)
+)
+
+func (f EventHandlerFunc) HandleEvent(e Event) {
+	f(e)
+}
+
+var (
+	// "** (mydumper:1234): WARNING **: 10:01:02.345: msg"
+	glibLevelLine = regexp.MustCompile(`^\*\* \([^)]*\): ([A-Z]+) \*\*: (.*)$`)
+	// "** Message: 10:01:02.345: msg"
+	glibMessageLine = regexp.MustCompile(`^\*\* ([A-Za-z]+): (.*)$`)
+	// "2022-10-11 12:30:25 [INFO] - msg"
+	bracketLevelLine = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} \[([A-Za-z]+)\] - (.*)$`)
+
+	threadPattern   = regexp.MustCompile(`\bThread (\d+)`)
+	tablePattern    = regexp.MustCompile("`([^`]+)`\\.`([^`]+)`")
+	databasePattern = regexp.MustCompile("database `([^`]+)`")
+)
+
+// parse one output line into an Event.
+func parseEvent(line string) Event {
+	e := Event{Kind: EventLog, Time: time.Now(), Thread: -1, Raw: line}
+
+	msg := line
+	if m := glibLevelLine.FindStringSubmatch(line); m != nil {
+		e.Level, msg = strings.ToLower(m[1]), m[2]
+	} else if m := glibMessageLine.FindStringSubmatch(line); m != nil {
+		e.Level, msg = strings.ToLower(m[1]), m[2]
+	} else if m := bracketLevelLine.FindStringSubmatch(line); m != nil {
+		e.Level, msg = strings.ToLower(m[1]), m[2]
+	}
+
+	// drop the glib timestamp.
+	if colon := strings.Index(msg, ": "); colon > 0 && isTimestamp(msg[:colon]) {
+		msg = msg[colon+2:]
+	}
+	e.Message = strings.TrimSpace(msg)
+
+	if m := threadPattern.FindStringSubmatch(e.Message); m != nil {
+		e.Thread, _ = strconv.Atoi(m[1])
+	}
+	if m := tablePattern.FindStringSubmatch(e.Message); m != nil {
+		e.Database, e.Table = m[1], m[2]
+	} else if m := databasePattern.FindStringSubmatch(e.Message); m != nil {
+		e.Database = m[1]
+	}
+	return e
+}
+
+// serializes events from the stdout and stderr copy goroutines and the
+// progress tracker. a nil dispatcher drops all events.
+type eventDispatcher struct {
+	mu      sync.Mutex
+	handler EventHandler
+}
+
+func newEventDispatcher(handler EventHandler) *eventDispatcher {
+	if handler == nil {
+		return nil
+	}
+	return &eventDispatcher{handler: handler}
+}
+
+// parse and send an output line.
+func (d *eventDispatcher) dispatch(line string) {
+	if d == nil || len(strings.TrimSpace(line)) == 0 {
+		return
+	}
+	d.send(parseEvent(line))
+}
+
+func (d *eventDispatcher) send(e Event) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handler.HandleEvent(e)
+}
+
+// send a warning about the run itself, not a line of output.
+func (d *eventDispatcher) warn(message string) {
+	d.send(Event{
+		Kind:    EventLog,
+		Time:    time.Now(),
+		Level:   LevelWarning,
+		Thread:  -1,
+		Message: message,
+	})
+}
+
+// io.Writer calling fn for each complete line.
+type lineWriter struct {
+	fn      func(line string)
+	partial bytes.Buffer
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial.Write(p)
+	for {
+		idx := bytes.IndexByte(w.partial.Bytes(), '\n')
+		if idx < 0 {
+			break
+		}
+		w.fn(string(bytes.TrimRight(w.partial.Next(idx+1), "\r\n")))
+	}
+	return len(p), nil
+}
+
+// pass on a final line without newline.
+func (w *lineWriter) Flush() {
+	if w.partial.Len() > 0 {
+		w.fn(w.partial.String())
+		w.partial.Reset()
+	}
+}
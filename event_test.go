@@ -0,0 +1,58 @@
+package mydumper
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseEvent(t *testing.T) {
+
+	cases := []struct {
+		line     string
+		level    string
+		thread   int
+		database string
+		table    string
+		message  string
+	}{
+		{"** Message: 10:01:02.345: Thread 3 dumping data for `db`.`t1`", LevelMessage, 3, "db", "t1", "Thread 3 dumping data for `db`.`t1`"},
+		{"** Message: Thread 1 dumping schema for `db`.`t2`", LevelMessage, 1, "db", "t2", "Thread 1 dumping schema for `db`.`t2`"},
+		{"** (mydumper:1234): WARNING **: 10:01:02.345: Broken table detected, please review: db.t1", LevelWarning, -1, "", "", "Broken table detected, please review: db.t1"},
+		{"** (myloader:1234): CRITICAL **: Error restoring `db`.`t3`", LevelCritical, -1, "db", "t3", "Error restoring `db`.`t3`"},
+		{"2022-10-11 12:30:25 [INFO] - Thread 2: dumping data for `db`.`t4`", LevelInfo, 2, "db", "t4", "Thread 2: dumping data for `db`.`t4`"},
+		{"** Message: 10:01:02.345: Creating database `db`", LevelMessage, -1, "db", "", "Creating database `db`"},
+	}
+
+	for _, c := range cases {
+		e := parseEvent(c.line)
+		if e.Level != c.level || e.Thread != c.thread || e.Database != c.database || e.Table != c.table || e.Message != c.message {
+			t.Errorf("%q: got %+v", c.line, e)
+		}
+	}
+}
+
+func TestDumpEvents(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper := newFakeDumper(t, dir,
+		"echo '** Message: 10:01:02.345: Thread 1 dumping data for `db`.`t1`' >&2; printf '** Message: Thread 2 dumping data for `db`.`t2`' >&2")
+	dumper.SetOutPutDir(dir)
+
+	events := make([]Event, 0)
+	dumper.SetEventHandler(EventHandlerFunc(func(e Event) {
+		events = append(events, e)
+	}))
+
+	if err := dumper.Dump(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if events[1].Thread != 2 || events[1].Table != "t2" {
+		t.Errorf("unexpected event %+v", events[1])
+	}
+}
@@ -0,0 +1,125 @@
+package mydumper
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// returned when the context passed to DumpContext or LoadContext is done
+// before mydumper/myloader exits.
+var ErrCancelled = errors.New("execution cancelled")
+
+// check whether err was caused by a cancelled or timed out context.
+func IsCancelled(err error) bool {
+	return errors.Cause(err) == ErrCancelled
+}
+
+// placeholder for the temporary defaults file in a reported command.
+const defaultsFilePlaceholder = "<defaults-file>"
+
+// full command line for path and args, as executed by run for a binary
+// with capabilities c.
+func command(path string, args []string, c Capabilities) []string {
+	cmd := make([]string, 0, len(args)+3)
+	cmd = append(cmd, path)
+	if !c.Known || c.DefaultsFile {
+		cmd = append(cmd, "--defaults-file", defaultsFilePlaceholder)
+	}
+	cmd = append(cmd, redactArgs(args)...)
+	return cmd
+}
+
+// report the command of a dry run to handler.
+func dryRun(handler EventHandler, cmd []string) {
+	if handler == nil {
+		return
+	}
+	handler.HandleEvent(Event{
+		Kind:    EventLog,
+		Time:    time.Now(),
+		Level:   LevelInfo,
+		Thread:  -1,
+		Message: "dry run: " + strings.Join(cmd, " "),
+	})
+}
+
+// run the binary in its own process group and wait for it.
+// when ctx is done the whole process group is killed, so helper processes
+// forked by mydumper/myloader do not outlive the call. an unsuccessful exit
+// is returned as *ExecError. env is added to the environment and every output
+// line is sent to events.
+func run(ctx context.Context, path string, args []string, env []string, events *eventDispatcher) error {
+	p, err := startProcess(path, args, env, events)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	select {
+	case err := <-p.done:
+		return errors.Trace(p.exitError(err))
+	case <-ctx.Done():
+		killProcessGroup(p.cmd)
+		<-p.done
+		return errors.Annotatef(ErrCancelled, "%s", ctx.Err())
+	}
+}
+
+// a started binary, see startProcess.
+type process struct {
+	path string
+	args []string
+	cmd  *exec.Cmd
+	tail *lineTail
+	// receives the result of cmd.Wait once the output is flushed.
+	done chan error
+}
+
+// start the binary in its own process group, see run.
+func startProcess(path string, args []string, env []string, events *eventDispatcher) (*process, error) {
+	p := &process{path: path, args: args, tail: newLineTail(stderrTailLines), done: make(chan error, 1)}
+
+	stdout := &lineWriter{fn: events.dispatch}
+	stderr := &lineWriter{fn: func(line string) {
+		p.tail.add(line)
+		events.dispatch(line)
+	}}
+
+	p.cmd = exec.Command(path, args...)
+	p.cmd.Stdout = stdout
+	p.cmd.Stderr = stderr
+	if len(env) > 0 {
+		p.cmd.Env = append(os.Environ(), env...)
+	}
+	setProcessGroup(p.cmd)
+
+	if err := p.cmd.Start(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	go func() {
+		err := p.cmd.Wait()
+		stdout.Flush()
+		stderr.Flush()
+		p.done <- err
+	}()
+	return p, nil
+}
+
+// the error of a wait result, *ExecError for an unsuccessful exit.
+func (p *process) exitError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return errors.Trace(newExecError(p.path, p.args, status, p.tail.Lines()))
+		}
+	}
+	return errors.Trace(err)
+}
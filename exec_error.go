@@ -0,0 +1,221 @@
+package mydumper
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// number of stderr lines kept in ExecError.
+const stderrTailLines = 20
+
+// classified reason of a failed mydumper/myloader run.
+type ErrorCause int
+
+const (
+	CauseUnknown ErrorCause = iota
+	// wrong user or password.
+	CauseAuth
+	// the database does not exist on the server.
+	CauseUnknownDatabase
+	// a lock could not be acquired in time.
+	CauseLockWaitTimeout
+	// no space left in the output directory.
+	CauseDiskFull
+	// the binary was killed by a signal.
+	CauseCrash
+)
+
+func (c ErrorCause) String() string {
+	switch c {
+	case CauseAuth:
+		return "auth failure"
+	case CauseUnknownDatabase:
+		return "unknown database"
+	case CauseLockWaitTimeout:
+		return "lock wait timeout"
+	case CauseDiskFull:
+		return "disk full"
+	case CauseCrash:
+		return "crash"
+	}
+	return "unknown"
+}
+
+// error returned when mydumper/myloader exits unsuccessfully.
+// use errors.Cause(err).(*ExecError) to inspect it.
+type ExecError struct {
+	// binary path.
+	Path string
+	// arguments with the password redacted.
+	Args []string
+	// exit code, -1 when the binary was killed by a signal.
+	ExitCode int
+	// signal that killed the binary, empty when it exited.
+	Signal string
+	// last lines written to stderr.
+	Stderr []string
+	// classified cause.
+	Cause ErrorCause
+	// first CRITICAL message, or the first WARNING when there is none.
+	Message string
+}
+
+func (e *ExecError) Error() string {
+	status := fmt.Sprintf("exit status %d", e.ExitCode)
+	if len(e.Signal) > 0 {
+		status = fmt.Sprintf("killed by signal %s", e.Signal)
+	}
+	if len(e.Message) > 0 {
+		return fmt.Sprintf("%s %s (%s): %s", e.Path, status, e.Cause, e.Message)
+	}
+	return fmt.Sprintf("%s %s (%s)", e.Path, status, e.Cause)
+}
+
+// build an ExecError from the wait status and the stderr tail.
+func newExecError(path string, args []string, status syscall.WaitStatus, stderr []string) *ExecError {
+	e := new(ExecError)
+	e.Path = path
+	e.Args = redactArgs(args)
+	e.ExitCode = status.ExitStatus()
+	e.Stderr = stderr
+
+	if status.Signaled() {
+		e.ExitCode = -1
+		e.Signal = status.Signal().String()
+		e.Cause = CauseCrash
+	}
+
+	critical, warning := logMessages(stderr)
+	e.Message = firstOf(critical, warning)
+
+	if e.Cause == CauseUnknown {
+		e.Cause = classify(critical)
+	}
+	if e.Cause == CauseUnknown {
+		e.Cause = classify(warning)
+	}
+	if e.Cause == CauseUnknown {
+		e.Cause = classify(stderr)
+	}
+	return e
+}
+
+// replace password values in args.
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+
+	for i := 0; i < len(redacted); i++ {
+		switch {
+		case redacted[i] == "--password" || redacted[i] == "-p":
+			if i+1 < len(redacted) {
+				redacted[i+1] = "********"
+				i++
+			}
+		case strings.HasPrefix(redacted[i], "--password="):
+			redacted[i] = "--password=********"
+		}
+	}
+	return redacted
+}
+
+// split glib log lines into CRITICAL and WARNING messages.
+// a line looks like "** (mydumper:1234): CRITICAL **: 10:01:02.345: Error connecting to database: ..."
+func logMessages(lines []string) ([]string, []string) {
+	critical := make([]string, 0)
+	warning := make([]string, 0)
+
+	for _, line := range lines {
+		if msg, ok := logMessage(line, "CRITICAL **:"); ok {
+			critical = append(critical, msg)
+		} else if msg, ok := logMessage(line, "WARNING **:"); ok {
+			warning = append(warning, msg)
+		}
+	}
+	return critical, warning
+}
+
+// message text following marker, without the leading timestamp.
+func logMessage(line string, marker string) (string, bool) {
+	idx := strings.Index(line, marker)
+	if idx < 0 {
+		return "", false
+	}
+	msg := strings.TrimSpace(line[idx+len(marker):])
+
+	// skip "10:01:02.345:" when present.
+	if colon := strings.Index(msg, ": "); colon > 0 && isTimestamp(msg[:colon]) {
+		msg = strings.TrimSpace(msg[colon+1:])
+	}
+	return msg, true
+}
+
+func isTimestamp(s string) bool {
+	if len(s) < 8 {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && c != ':' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func firstOf(lists ...[]string) string {
+	for _, list := range lists {
+		if len(list) > 0 {
+			return list[0]
+		}
+	}
+	return ""
+}
+
+// known error texts and their causes.
+var causePatterns = []struct {
+	pattern string
+	cause   ErrorCause
+}{
+	{"access denied for user", CauseAuth},
+	{"unknown database", CauseUnknownDatabase},
+	{"lock wait timeout exceeded", CauseLockWaitTimeout},
+	{"no space left on device", CauseDiskFull},
+	{"disk full", CauseDiskFull},
+}
+
+// first cause matching one of the messages.
+func classify(messages []string) ErrorCause {
+	for _, msg := range messages {
+		lower := strings.ToLower(msg)
+		for _, p := range causePatterns {
+			if strings.Contains(lower, p.pattern) {
+				return p.cause
+			}
+		}
+	}
+	return CauseUnknown
+}
+
+// the last max lines passed to add.
+type lineTail struct {
+	max   int
+	lines []string
+}
+
+func newLineTail(max int) *lineTail {
+	return &lineTail{max: max, lines: make([]string, 0, max)}
+}
+
+func (t *lineTail) add(line string) {
+	if len(t.lines) == t.max {
+		t.lines = append(t.lines[:0], t.lines[1:]...)
+	}
+	t.lines = append(t.lines, line)
+}
+
+func (t *lineTail) Lines() []string {
+	lines := make([]string, len(t.lines))
+	copy(lines, t.lines)
+	return lines
+}
@@ -0,0 +1,63 @@
+package mydumper
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+)
+
+func TestExecErrorCause(t *testing.T) {
+
+	cases := []struct {
+		line  string
+		cause ErrorCause
+	}{
+		{"** (mydumper:1): CRITICAL **: 10:01:02.345: Error connecting to database: Access denied for user 'root'@'10.0.0.1' (using password: YES)", CauseAuth},
+		{"** (mydumper:1): CRITICAL **: Error switching to database dev: Unknown database 'dev'", CauseUnknownDatabase},
+		{"** (myloader:1): CRITICAL **: 10:01:02.345: Error restoring dev.t1 from file dev.t1.sql: Lock wait timeout exceeded; try restarting transaction", CauseLockWaitTimeout},
+		{"** (mydumper:1): CRITICAL **: 10:01:02.345: Error: DB: dev TABLE: t1 Could not write out data: No space left on device", CauseDiskFull},
+		{"** (mydumper:1): WARNING **: 10:01:02.345: Broken table detected, please review: dev.t1", CauseUnknown},
+	}
+
+	for _, c := range cases {
+		critical, warning := logMessages([]string{c.line})
+		cause := classify(critical)
+		if cause == CauseUnknown {
+			cause = classify(warning)
+		}
+		if cause != c.cause {
+			t.Errorf("%q: expected %s, got %s", c.line, c.cause, cause)
+		}
+	}
+}
+
+func TestExecErrorFromBinary(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper := newFakeDumper(t, dir,
+		"echo \"** (mydumper:1): CRITICAL **: 10:01:02.345: Error connecting to database: Access denied for user 'root'@'localhost'\" >&2; exit 2")
+	dumper.SetOutPutDir(dir)
+
+	err := dumper.Dump()
+	execErr, ok := errors.Cause(err).(*ExecError)
+	if !ok {
+		t.Fatalf("expected *ExecError, got %v", err)
+	}
+
+	if execErr.ExitCode != 2 {
+		t.Errorf("expected exit code 2, got %d", execErr.ExitCode)
+	}
+	if execErr.Cause != CauseAuth {
+		t.Errorf("expected auth failure, got %s", execErr.Cause)
+	}
+	if !strings.HasPrefix(execErr.Message, "Error connecting to database") {
+		t.Errorf("unexpected message %q", execErr.Message)
+	}
+	if strings.Contains(strings.Join(execErr.Args, " "), "111111") {
+		t.Errorf("password not redacted: %v", execErr.Args)
+	}
+}
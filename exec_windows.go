@@ -0,0 +1,22 @@
+//go:build windows
+// +build windows
+
+package mydumper
+
+import "os/exec"
+
+// process groups are not available, the child is killed on its own.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// kill the child process.
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+// signals are not available, the child is killed.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return killProcessGroup(cmd)
+}
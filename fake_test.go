@@ -0,0 +1,63 @@
+package mydumper
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// the tests run mydumper/myloader as shell scripts, each test passes the
+// body its case needs and the version it reports.
+
+// write an executable shell script standing in for mydumper/myloader 0.10.0.
+func fakeBinary(t *testing.T, dir string, name string, body string) string {
+	return fakeBinaryVersion(t, dir, name, "0.10.0", body)
+}
+
+// write an executable shell script standing in for mydumper/myloader,
+// answering --version with version and running body otherwise.
+func fakeBinaryVersion(t *testing.T, dir string, name string, version string, body string) string {
+	path := filepath.Join(dir, name)
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = \"--version\" ]; then echo \"" + name + " " + version + ", built against MySQL 5.7.21\"; exit 0; fi\n" +
+		body + "\n"
+	if err := ioutil.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// temporary directory of a test, removed by the caller.
+func fakeDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "mydumper")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// Dumper running a fake mydumper 0.10.0 in dir.
+func newFakeDumper(t *testing.T, dir string, body string) *Dumper {
+	return newFakeDumperVersion(t, dir, "0.10.0", body)
+}
+
+func newFakeDumperVersion(t *testing.T, dir string, version string, body string) *Dumper {
+	dumper, err := NewDumper(fakeBinaryVersion(t, dir, "mydumper", version, body), "127.0.0.1", 3306, "root", "111111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dumper
+}
+
+// Loader running a fake myloader 0.10.0 in dir.
+func newFakeLoader(t *testing.T, dir string, body string) *Loader {
+	return newFakeLoaderVersion(t, dir, "0.10.0", body)
+}
+
+func newFakeLoaderVersion(t *testing.T, dir string, version string, body string) *Loader {
+	loader, err := NewLoader(fakeBinaryVersion(t, dir, "myloader", version, body), "127.0.0.1", 3306, "root", "111111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loader
+}
@@ -0,0 +1,232 @@
+package mydumper
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+type (
+	// transactions Start to End of one server, both included.
+	GTIDInterval struct {
+		Start uint64 `json:"start"`
+		End   uint64 `json:"end"`
+	}
+
+	// MySQL GTID set, server uuid to sorted and merged intervals.
+	// operations return new sets and never modify their operands.
+	GTIDSet map[string][]GTIDInterval
+)
+
+// parse a GTID set such as
+// "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5:7,2174b383-5441-11e8-b90a-c80aa9429562:1-77".
+// whitespace and newlines, as found in metadata files, are ignored.
+func ParseGTIDSet(s string) (GTIDSet, error) {
+	set := make(GTIDSet)
+
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) == 0 {
+		return set, nil
+	}
+
+	for _, member := range strings.Split(s, ",") {
+		parts := strings.Split(member, ":")
+		if len(parts) < 2 {
+			return nil, errors.NotValidf("GTID %q", member)
+		}
+
+		uuid := strings.ToLower(parts[0])
+		if !isUUID(uuid) {
+			return nil, errors.NotValidf("server uuid %q", parts[0])
+		}
+
+		for _, part := range parts[1:] {
+			interval, err := parseGTIDInterval(part)
+			if err != nil {
+				return nil, errors.Annotatef(err, "GTID %q", member)
+			}
+			set[uuid] = append(set[uuid], interval)
+		}
+		set[uuid] = normalizeIntervals(set[uuid])
+	}
+	return set, nil
+}
+
+// "7" or "1-5".
+func parseGTIDInterval(s string) (GTIDInterval, error) {
+	bounds := strings.SplitN(s, "-", 2)
+
+	start, err := strconv.ParseUint(bounds[0], 10, 64)
+	if err != nil || start == 0 {
+		return GTIDInterval{}, errors.NotValidf("interval %q", s)
+	}
+	end := start
+	if len(bounds) == 2 {
+		end, err = strconv.ParseUint(bounds[1], 10, 64)
+		if err != nil || end < start {
+			return GTIDInterval{}, errors.NotValidf("interval %q", s)
+		}
+	}
+	return GTIDInterval{Start: start, End: end}, nil
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sort intervals and merge the overlapping and adjacent ones.
+func normalizeIntervals(intervals []GTIDInterval) []GTIDInterval {
+	sorted := make([]GTIDInterval, len(intervals))
+	copy(sorted, intervals)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	merged := make([]GTIDInterval, 0, len(sorted))
+	for _, interval := range sorted {
+		last := len(merged) - 1
+		if last >= 0 && interval.Start <= merged[last].End+1 {
+			if interval.End > merged[last].End {
+				merged[last].End = interval.End
+			}
+			continue
+		}
+		merged = append(merged, interval)
+	}
+	return merged
+}
+
+// canonical form, sorted by server uuid.
+func (s GTIDSet) String() string {
+	uuids := s.uuids()
+
+	buf := new(bytes.Buffer)
+	for i, uuid := range uuids {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString(uuid)
+		for _, interval := range s[uuid] {
+			if interval.Start == interval.End {
+				fmt.Fprintf(buf, ":%d", interval.Start)
+			} else {
+				fmt.Fprintf(buf, ":%d-%d", interval.Start, interval.End)
+			}
+		}
+	}
+	return buf.String()
+}
+
+// server uuids with at least one transaction, sorted.
+func (s GTIDSet) uuids() []string {
+	uuids := make([]string, 0, len(s))
+	for uuid, intervals := range s {
+		if len(intervals) > 0 {
+			uuids = append(uuids, uuid)
+		}
+	}
+	sort.Strings(uuids)
+	return uuids
+}
+
+// set has no transactions.
+func (s GTIDSet) IsEmpty() bool {
+	return len(s.uuids()) == 0
+}
+
+// transactions in s or o.
+func (s GTIDSet) Union(o GTIDSet) GTIDSet {
+	union := make(GTIDSet)
+	for uuid, intervals := range s {
+		union[uuid] = append(union[uuid], intervals...)
+	}
+	for uuid, intervals := range o {
+		union[uuid] = append(union[uuid], intervals...)
+	}
+	for uuid, intervals := range union {
+		union[uuid] = normalizeIntervals(intervals)
+	}
+	return union
+}
+
+// transactions in s but not in o.
+func (s GTIDSet) Subtract(o GTIDSet) GTIDSet {
+	diff := make(GTIDSet)
+	for uuid, intervals := range s {
+		remaining := normalizeIntervals(intervals)
+		for _, cut := range o[uuid] {
+			remaining = subtractInterval(remaining, cut)
+		}
+		if len(remaining) > 0 {
+			diff[uuid] = remaining
+		}
+	}
+	return diff
+}
+
+// remove cut from every interval.
+func subtractInterval(intervals []GTIDInterval, cut GTIDInterval) []GTIDInterval {
+	result := make([]GTIDInterval, 0, len(intervals)+1)
+	for _, interval := range intervals {
+		if cut.End < interval.Start || cut.Start > interval.End {
+			result = append(result, interval)
+			continue
+		}
+		if cut.Start > interval.Start {
+			result = append(result, GTIDInterval{Start: interval.Start, End: cut.Start - 1})
+		}
+		if cut.End < interval.End {
+			result = append(result, GTIDInterval{Start: cut.End + 1, End: interval.End})
+		}
+	}
+	return result
+}
+
+// every transaction of o is in s.
+func (s GTIDSet) Contains(o GTIDSet) bool {
+	return o.Subtract(s).IsEmpty()
+}
+
+// s and o hold the same transactions.
+func (s GTIDSet) Equal(o GTIDSet) bool {
+	return s.Contains(o) && o.Contains(s)
+}
+
+// GTID set of the dumped server.
+func (m *MetaData) GTIDSet() (GTIDSet, error) {
+	return ParseGTIDSet(m.BinLogUuid)
+}
+
+// executed GTID set of the master status.
+func (s *MasterStatus) GTIDSet() (GTIDSet, error) {
+	return ParseGTIDSet(s.GTID)
+}
+
+// executed GTID set of the replica status.
+func (s *ReplicaStatus) GTIDSet() (GTIDSet, error) {
+	return ParseGTIDSet(s.GTID)
+}
@@ -0,0 +1,75 @@
+package mydumper
+
+import "testing"
+
+const (
+	uuidA = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	uuidB = "2174b383-5441-11e8-b90a-c80aa9429562"
+)
+
+func mustParseGTIDSet(t *testing.T, s string) GTIDSet {
+	set, err := ParseGTIDSet(s)
+	if err != nil {
+		t.Fatalf("%q: %s", s, err)
+	}
+	return set
+}
+
+func TestParseGTIDSet(t *testing.T) {
+
+	cases := map[string]string{
+		"":                                       "",
+		uuidA + ":1-5":                           uuidA + ":1-5",
+		uuidA + ":1-5:6:8-9":                     uuidA + ":1-6:8-9",
+		uuidA + ":7:1-5,\n" + uuidB + ":1-77":    uuidB + ":1-77," + uuidA + ":1-5:7",
+		"3E11FA47-71CA-11E1-9E33-C80AA9429562:3": uuidA + ":3",
+	}
+
+	for s, expected := range cases {
+		if got := mustParseGTIDSet(t, s).String(); got != expected {
+			t.Errorf("%q: expected %q, got %q", s, expected, got)
+		}
+	}
+
+	for _, s := range []string{"abc:1-5", uuidA, uuidA + ":5-1", uuidA + ":0", uuidA + ":x"} {
+		if _, err := ParseGTIDSet(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestGTIDSetOperations(t *testing.T) {
+
+	backup := mustParseGTIDSet(t, uuidA+":1-100,"+uuidB+":1-10")
+	replica := mustParseGTIDSet(t, uuidA+":1-50:60-70")
+
+	if got := backup.Union(replica).String(); got != backup.String() {
+		t.Errorf("union: got %q", got)
+	}
+	if got := backup.Subtract(replica).String(); got != uuidB+":1-10,"+uuidA+":51-59:71-100" {
+		t.Errorf("subtract: got %q", got)
+	}
+	if got := replica.Subtract(backup); !got.IsEmpty() {
+		t.Errorf("subtract: expected empty set, got %q", got)
+	}
+
+	if !backup.Contains(replica) || replica.Contains(backup) {
+		t.Errorf("contains: wrong result")
+	}
+	if !backup.Equal(mustParseGTIDSet(t, uuidB+":1-5:6-10,"+uuidA+":1-100")) || backup.Equal(replica) {
+		t.Errorf("equal: wrong result")
+	}
+}
+
+func TestMetadataGTIDSet(t *testing.T) {
+
+	meta := readTestMetadata(t, "testdata/multisource")
+
+	set, err := meta.GTIDSet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !set.Contains(mustParseGTIDSet(t, uuidA+":1-5,"+uuidB+":77")) {
+		t.Errorf("unexpected set %s", set)
+	}
+}
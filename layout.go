@@ -0,0 +1,108 @@
+package mydumper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// output directory layouts of Dumper.
+const (
+	// every dump writes to OutPutDir.
+	LayoutFlat = "flat"
+	// every dump writes to OutPutDir/<host>_<port>/<run id>/, see RunDir.
+	LayoutPerRun = "per-run"
+)
+
+// name of the link to the last successful run in a per-run layout.
+const LatestRunName = "latest"
+
+// suffix of runs that failed or were cancelled in a per-run layout.
+const FailedRunSuffix = ".failed"
+
+// directory holding the runs of one server.
+func runBaseDir(base string, addr string, port uint64) string {
+	host := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, addr)
+	return filepath.Join(base, fmt.Sprintf("%s_%d", host, port))
+}
+
+// run id, the UTC start time. sorts in start order.
+func runID(now time.Time) string {
+	return now.UTC().Format("20060102T150405Z")
+}
+
+// create a new run directory in base, adding a sequence number when a run
+// started in the same second.
+func newRunDir(base string, now time.Time) (string, error) {
+	if err := os.MkdirAll(base, 0755); err != nil {
+		return "", errors.Trace(err)
+	}
+
+	id := runID(now)
+	for seq := 1; ; seq++ {
+		dir := filepath.Join(base, id)
+		if seq > 1 {
+			dir = fmt.Sprintf("%s-%d", dir, seq)
+		}
+
+		err := os.Mkdir(dir, 0755)
+		if err == nil {
+			return dir, nil
+		}
+		if !os.IsExist(err) {
+			return "", errors.Trace(err)
+		}
+	}
+}
+
+// point the latest link of base at dir. the link is replaced with a rename,
+// readers see either the old or the new run.
+func switchLatest(base string, dir string) error {
+	tmp := filepath.Join(base, "."+LatestRunName+"-"+filepath.Base(dir))
+	os.Remove(tmp)
+
+	if err := os.Symlink(filepath.Base(dir), tmp); err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(base, LatestRunName)); err != nil {
+		os.Remove(tmp)
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// rename a failed run so it is never taken for a good one.
+func quarantineRun(dir string) (string, error) {
+	failed := dir + FailedRunSuffix
+	if err := os.Rename(dir, failed); err != nil {
+		return "", errors.Trace(err)
+	}
+	return failed, nil
+}
+
+// directory of the last successful run of addr:port in a per-run layout under base.
+func LatestRun(base string, addr string, port uint64) (string, error) {
+	runs := runBaseDir(base, addr, port)
+
+	target, err := os.Readlink(filepath.Join(runs, LatestRunName))
+	if os.IsNotExist(err) {
+		return "", errors.NotFoundf("successful run in %s", runs)
+	}
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(runs, target)
+	}
+	return target, nil
+}
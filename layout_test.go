@@ -0,0 +1,114 @@
+package mydumper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+)
+
+func TestDumpPerRunLayout(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	base := filepath.Join(dir, "backup")
+	runs := filepath.Join(base, "127.0.0.1_3306")
+
+	// mydumper is called with "--defaults-file file --host ..." and writes to --outputdir.
+	script := `while [ $# -gt 0 ]; do if [ "$1" = "--outputdir" ]; then out="$2"; fi; shift; done
+echo "Started dump at: 2019-01-01 10:00:00" > "$out/metadata"`
+	dumper := newFakeDumper(t, dir, script)
+	dumper.SetOutPutDir(base)
+	dumper.SetLayout(LayoutPerRun)
+
+	if _, err := LatestRun(base, "127.0.0.1", 3306); !errors.IsNotFound(err) {
+		t.Errorf("expected not found before the first run, got %v", err)
+	}
+
+	if err := dumper.Dump(); err != nil {
+		t.Fatal(err)
+	}
+	first := dumper.RunDir()
+	if err := dumper.Dump(); err != nil {
+		t.Fatal(err)
+	}
+	second := dumper.RunDir()
+
+	if first == second || filepath.Dir(first) != runs || filepath.Dir(second) != runs {
+		t.Fatalf("unexpected run directories %s %s", first, second)
+	}
+	for _, run := range []string{first, second} {
+		if _, err := os.Stat(filepath.Join(run, "metadata")); err != nil {
+			t.Errorf("%s: %v", run, err)
+		}
+	}
+
+	latest, err := LatestRun(base, "127.0.0.1", 3306)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest != second {
+		t.Errorf("expected latest %s, got %s", second, latest)
+	}
+
+	dumper.ExecutionPath = fakeBinary(t, dir, "mydumper", script+"\nexit 1")
+	if err := dumper.Dump(); err == nil {
+		t.Fatal("expected error")
+	}
+	failed := dumper.RunDir()
+	if !strings.HasSuffix(failed, FailedRunSuffix) {
+		t.Errorf("failed run not quarantined: %s", failed)
+	}
+	if _, err := os.Stat(filepath.Join(failed, "metadata")); err != nil {
+		t.Errorf("failed run lost its files: %v", err)
+	}
+	if latest, _ := LatestRun(base, "127.0.0.1", 3306); latest != second {
+		t.Errorf("latest moved to %s after a failed run", latest)
+	}
+}
+
+func TestDumpLatestRunWarning(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	base := filepath.Join(dir, "backup")
+	runs := filepath.Join(base, "127.0.0.1_3306")
+
+	// a non-empty directory in the way of the link fails the switch.
+	if err := os.MkdirAll(filepath.Join(runs, LatestRunName, "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	script := `while [ $# -gt 0 ]; do if [ "$1" = "--outputdir" ]; then out="$2"; fi; shift; done
+echo "Started dump at: 2019-01-01 10:00:00" > "$out/metadata"`
+	dumper := newFakeDumper(t, dir, script)
+	dumper.SetOutPutDir(base)
+	dumper.SetLayout(LayoutPerRun)
+
+	var warning string
+	dumper.SetEventHandler(EventHandlerFunc(func(e Event) {
+		if e.Level == LevelWarning {
+			warning = e.Message
+		}
+	}))
+
+	if err := dumper.Dump(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(warning, LatestRunName) {
+		t.Errorf("expected a warning about %s, got %q", LatestRunName, warning)
+	}
+	if run := dumper.RunDir(); strings.HasSuffix(run, FailedRunSuffix) {
+		t.Errorf("complete run quarantined: %s", run)
+	}
+}
+
+func TestRunBaseDir(t *testing.T) {
+	if dir := runBaseDir("/backup", "fe80::1", 3306); dir != "/backup/fe80__1_3306" {
+		t.Errorf("unexpected %s", dir)
+	}
+}
@@ -1,10 +1,13 @@
 package mydumper
 
 import (
-	"bytes"
+	"context"
 	"fmt"
+	"os"
 	"os/exec"
 	"runtime"
+	"sync"
+	"time"
 
 	"github.com/juju/errors"
 )
@@ -13,6 +16,9 @@ type (
 	Loader struct {
 		// execution path
 		ExecutionPath string `json:"execution_path" db:"execution_path"`
+		// detected myloader version and the options it supports.
+		Version      Version      `json:"version" db:"-"`
+		Capabilities Capabilities `json:"capabilities" db:"-"`
 
 		// mysql database information.
 		Addr     string `json:"addr" db:"addr"`
@@ -28,6 +34,25 @@ type (
 		EnableBinlog          bool   `json:"enable_binlog" db:"enable_binlog"`
 		Threads               uint64 `json:"threads" db:"threads"`
 		CompressProtocol      bool   `json:"compress_protocol" db:"compress_protocol"`
+		// session character set, passed with --set-names. default is the one
+		// recorded in the metadata file of Directory.
+		Charset string `json:"character" db:"character"`
+
+		// verbosity of output, 0 = silent, 1 = errors, 2 = warnings, 3 = info. default 2
+		Verbose uint64 `json:"verbose" db:"verbose"`
+		// receive the output lines of myloader.
+		EventHandler EventHandler `json:"-" db:"-"`
+		// only report the command, do not execute myloader.
+		DryRun bool `json:"dry_run" db:"dry_run"`
+		// how long to wait for another run holding the lock of Directory.
+		// 0 fails at once with ErrDirectoryLocked, negative waits until the
+		// context is done.
+		LockTimeout time.Duration `json:"lock_timeout" db:"lock_timeout"`
+		// record every load in the catalog, nil disables.
+		Catalog *Catalog `json:"-" db:"-"`
+
+		mu     sync.Mutex
+		record *Recorder
 	}
 )
 
@@ -42,8 +67,15 @@ func NewLoader(execution_path string, addr string, port uint64, user string, pas
 		return nil, errors.Trace(err)
 	}
 
+	version, capabilities, err := detectVersion(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
 	d := new(Loader)
 	d.ExecutionPath = path
+	d.Version = version
+	d.Capabilities = capabilities
 	d.Addr = addr
 	d.Port = port
 	d.User = user
@@ -57,6 +89,7 @@ func NewLoader(execution_path string, addr string, port uint64, user string, pas
 	d.EnableBinlog = false
 	d.Threads = uint64(runtime.NumCPU())
 	d.CompressProtocol = false
+	d.Verbose = 2
 
 	return d, nil
 }
@@ -91,7 +124,7 @@ func (l *Loader) SetRestoreDatabase(database string) {
 	l.SourceDB = database
 }
 
-//set threads
+// set threads
 func (l *Loader) SetThreads(threads uint64) {
 	l.Threads = threads
 }
@@ -101,11 +134,128 @@ func (l *Loader) SetCompressProtocol(compress bool) {
 	l.CompressProtocol = compress
 }
 
-// execute load
+// set character set.
+func (l *Loader) SetCharacterSet(charset string) {
+	l.Charset = charset
+}
+
+// set verbosity
+func (l *Loader) SetVerbose(verbose uint64) {
+	l.Verbose = verbose
+}
+
+// set event handler. verbose 3 is needed to receive per table messages.
+func (l *Loader) SetEventHandler(handler EventHandler) {
+	l.EventHandler = handler
+}
+
+// enable/disable dry run
+func (l *Loader) SetDryRun(enable bool) {
+	l.DryRun = enable
+}
+
+// set how long to wait for the directory lock
+func (l *Loader) SetLockTimeout(timeout time.Duration) {
+	l.LockTimeout = timeout
+}
+
+// set catalog to record loads in
+func (l *Loader) SetCatalog(catalog *Catalog) {
+	l.Catalog = catalog
+}
+
+// catalog record of the running or last load. Catalog must be set.
+func (l *Loader) Record() (*Recorder, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.record == nil {
+		return nil, errors.NotFoundf("catalog record")
+	}
+	r := *l.record
+	return &r, nil
+}
+
+// the command Load would execute, starting with the myloader path.
+func (l *Loader) Command() ([]string, error) {
+	args, err := l.BuildArgs()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return command(l.ExecutionPath, args, l.Capabilities), nil
+}
+
+// execute load. the configuration is checked with Validate first.
 func (l *Loader) Load() error {
+	return l.LoadContext(context.Background())
+}
 
-	var out bytes.Buffer
-	var stderr bytes.Buffer
+// execute load, killing myloader when ctx is done.
+// the error satisfies IsCancelled when the load was cancelled.
+// with a Catalog the load is recorded as an OperationRestore run.
+// the directory is locked for the load, see LockTimeout, unless the lock file
+// cannot be written there. a missing directory fails with a NotFound error.
+func (l *Loader) LoadContext(ctx context.Context) error {
+
+	args, err := l.BuildArgs()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if l.DryRun {
+		dryRun(l.EventHandler, command(l.ExecutionPath, args, l.Capabilities))
+		return nil
+	}
+
+	lock, err := lockBackupDir(ctx, l.Directory, l.LockTimeout)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer lock.unlock()
+
+	record, err := startRecord(l.Catalog, OperationRestore, l.Directory, l.Version)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	l.mu.Lock()
+	l.record = record
+	l.mu.Unlock()
+
+	err = l.execute(ctx, args)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return errors.Trace(finishRecord(l.Catalog, record, l.Directory, err))
+}
+
+func (l *Loader) execute(ctx context.Context, args []string) error {
+	// the password goes into a defaults file or the environment, never into argv.
+	creds, err := newCredentials(l.Capabilities, l.Password)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer creds.remove()
+	args = append(creds.args, args...)
+
+	err = run(ctx, l.ExecutionPath, args, creds.env, newEventDispatcher(l.EventHandler))
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return nil
+}
+
+// build myloader arguments. the password is not part of them, it is passed
+// through a temporary defaults file when myloader is executed.
+func (l *Loader) BuildArgs() ([]string, error) {
+
+	if err := l.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	charset, err := l.charset()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
 
 	// define arg
 	args := make([]string, 0, 30)
@@ -116,8 +266,6 @@ func (l *Loader) Load() error {
 	args = append(args, fmt.Sprintf("%d", l.Port))
 	args = append(args, fmt.Sprintf("--user"))
 	args = append(args, fmt.Sprintf("%s", l.User))
-	args = append(args, fmt.Sprintf("--password"))
-	args = append(args, fmt.Sprintf("%s", l.Password))
 
 	args = append(args, fmt.Sprintf("--directory"))
 	args = append(args, fmt.Sprintf("%s", l.Directory))
@@ -147,16 +295,57 @@ func (l *Loader) Load() error {
 		args = append(args, fmt.Sprintf("--compress-protocol"))
 	}
 
+	if len(charset) > 0 {
+		args = append(args, fmt.Sprintf("--set-names"))
+		args = append(args, fmt.Sprintf("%s", charset))
+	}
+
 	args = append(args, fmt.Sprintf("--threads"))
 	args = append(args, fmt.Sprintf("%d", l.Threads))
 
-	cmd := exec.Command(l.ExecutionPath, args...)
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-	err := cmd.Run()
+	args = append(args, fmt.Sprintf("--verbose"))
+	args = append(args, fmt.Sprintf("%d", l.Verbose))
+
+	return args, nil
+}
+
+// character set to restore with. an explicit Charset must be supported by
+// myloader, one recorded in the metadata is only used when supported.
+func (l *Loader) charset() (string, error) {
+	supported := !l.Capabilities.Known || l.Capabilities.SetNames
+
+	if len(l.Charset) > 0 {
+		charset, err := checkCharset(l.Charset, "")
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		if !supported {
+			return "", errors.NotSupportedf("--set-names by myloader %s", l.Version)
+		}
+		return charset, nil
+	}
+
+	if !supported {
+		return "", nil
+	}
+	meta, err := NewMeta(l.Directory)
 	if err != nil {
-		return errors.Trace(err)
+		return "", nil
 	}
-	return nil
+	if err := meta.ReadMetadata(); err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			l.warn(fmt.Sprintf("cannot read the recorded character set: %s", err))
+		}
+		return "", nil
+	}
+	charset, err := checkCharset(meta.Charset, meta.Collation)
+	if err != nil {
+		l.warn(fmt.Sprintf("recorded character set not used: %s", err))
+		return "", nil
+	}
+	return charset, nil
+}
 
+func (l *Loader) warn(message string) {
+	newEventDispatcher(l.EventHandler).warn(message)
 }
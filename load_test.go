@@ -1,6 +1,11 @@
 package mydumper
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
 
 func TestLoad(t *testing.T) {
 
@@ -18,3 +23,32 @@ func TestLoad(t *testing.T) {
 	}
 
 }
+
+func TestLoadBuildArgs(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "myloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	loader := newFakeLoader(t, dir, "")
+	loader.SetSourceDirectory("/data/backup")
+	loader.SetRestoreDatabase("test")
+	loader.SetOverwriteTables(false)
+
+	args, err := loader.BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	joined := strings.Join(args, " ")
+	for _, expected := range []string{"--host 127.0.0.1", "--directory /data/backup", "--source-db test"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("missing %q in %q", expected, joined)
+		}
+	}
+	if strings.Contains(joined, "--overwrite-tables") {
+		t.Errorf("unexpected --overwrite-tables in %q", joined)
+	}
+}
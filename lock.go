@@ -0,0 +1,194 @@
+package mydumper
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// name of the lock file a dump or load takes in its directory.
+const LockFileName = ".go-mydumper.lock"
+
+// returned when another Dumper or Loader holds the lock of the directory.
+var ErrDirectoryLocked = errors.New("directory is locked")
+
+// check whether err was caused by a directory locked by another run.
+func IsDirectoryLocked(err error) bool {
+	return errors.Cause(err) == ErrDirectoryLocked
+}
+
+// lockFile found the file locked.
+var errLockBusy = errors.New("lock busy")
+
+// interval between attempts while waiting for a lock.
+const lockRetryInterval = 100 * time.Millisecond
+
+// exclusive lock of a directory, see lockDir.
+type dirLock struct {
+	fd *os.File
+}
+
+// lock dir, creating it when missing. with wait 0 a locked dir fails at
+// once, a positive wait retries that long and a negative one until ctx is done.
+func lockDir(ctx context.Context, dir string, wait time.Duration) (*dirLock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return waitLock(ctx, dir, wait)
+}
+
+// lock the backup dir a load reads, see lockDir. a missing dir is not created.
+// a dir the lock file cannot be written in, such as a read-only mount, is
+// not locked: no run can delete its files either.
+func lockBackupDir(ctx context.Context, dir string, wait time.Duration) (*dirLock, error) {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return nil, errors.NotFoundf("backup directory %s", dir)
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if !info.IsDir() {
+		return nil, errors.NotValidf("backup directory %s", dir)
+	}
+
+	l, err := waitLock(ctx, dir, wait)
+	if err != nil && isReadOnly(err) {
+		return nil, nil
+	}
+	return l, errors.Trace(err)
+}
+
+// err was caused by a read-only file system or missing write permission.
+func isReadOnly(err error) bool {
+	err = errors.Cause(err)
+	if os.IsPermission(err) {
+		return true
+	}
+	if pe, ok := err.(*os.PathError); ok {
+		return pe.Err == syscall.EROFS
+	}
+	return false
+}
+
+// lock the existing dir, see lockDir.
+func waitLock(ctx context.Context, dir string, wait time.Duration) (*dirLock, error) {
+	var deadline <-chan time.Time
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		l, pid, err := tryLockDir(dir)
+		if err != nil || l != nil {
+			return l, err
+		}
+
+		locked := errors.Annotatef(ErrDirectoryLocked, "%s is used by pid %d", dir, pid)
+		if wait == 0 {
+			return nil, locked
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.Trace(ErrCancelled)
+		case <-deadline:
+			return nil, locked
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// one attempt to lock dir. a nil lock and no error means it is held by pid.
+func tryLockDir(dir string) (*dirLock, int, error) {
+	fd, err := os.OpenFile(filepath.Join(dir, LockFileName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, 0, errors.Trace(err)
+	}
+
+	err = lockFile(fd)
+	if err == errLockBusy {
+		pid := lockOwner(fd)
+		fd.Close()
+		return nil, pid, nil
+	}
+	if err != nil {
+		fd.Close()
+		return nil, 0, errors.Trace(err)
+	}
+
+	if err := fd.Truncate(0); err != nil {
+		unlockFile(fd)
+		fd.Close()
+		return nil, 0, errors.Trace(err)
+	}
+	if _, err := fd.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0); err != nil {
+		unlockFile(fd)
+		fd.Close()
+		return nil, 0, errors.Trace(err)
+	}
+	return &dirLock{fd: fd}, 0, nil
+}
+
+// pid recorded in the lock file, 0 when none.
+func lockOwner(fd *os.File) int {
+	if _, err := fd.Seek(0, 0); err != nil {
+		return 0
+	}
+	data, err := ioutil.ReadAll(fd)
+	if err != nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0
+	}
+	return pid
+}
+
+// release the lock. the file stays, removing it would race with a waiting run.
+func (l *dirLock) unlock() error {
+	if l == nil {
+		return nil
+	}
+	l.fd.Truncate(0)
+	unlockFile(l.fd)
+	return errors.Trace(l.fd.Close())
+}
+
+// remove dir holding the lock, then release it. where the open lock file
+// blocks the removal, everything else goes first and the file last.
+func (l *dirLock) remove(dir string) error {
+	if lockRemovableWhileOpen {
+		err := os.RemoveAll(dir)
+		unlockFile(l.fd)
+		l.fd.Close()
+		return errors.Trace(err)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		l.unlock()
+		return errors.Trace(err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == LockFileName {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			l.unlock()
+			return errors.Trace(err)
+		}
+	}
+	unlockFile(l.fd)
+	l.fd.Close()
+	return errors.Trace(os.RemoveAll(dir))
+}
@@ -0,0 +1,158 @@
+package mydumper
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+func TestLockDir(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	lock, err := lockDir(ctx, dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lockDir(ctx, dir, 0); !IsDirectoryLocked(err) {
+		t.Fatalf("expected directory locked, got %v", err)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	if _, err := lockDir(timeout, dir, -1); !IsCancelled(err) {
+		t.Errorf("expected cancelled, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		lock.unlock()
+	}()
+	again, err := lockDir(ctx, dir, 5*time.Second)
+	if err != nil {
+		t.Fatalf("expected the lock after release, got %v", err)
+	}
+	again.unlock()
+}
+
+func TestLockDirStale(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the pid of a process that has exited.
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip(err)
+	}
+	pid := strconv.Itoa(cmd.Process.Pid)
+	if err := ioutil.WriteFile(filepath.Join(dir, LockFileName), []byte(pid+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := lockDir(context.Background(), dir, 0)
+	if err != nil {
+		t.Fatalf("stale lock was not taken over: %v", err)
+	}
+	defer lock.unlock()
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, LockFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != strconv.Itoa(os.Getpid())+"\n" {
+		t.Errorf("unexpected lock owner %q", data)
+	}
+}
+
+func TestLockBackupDir(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.Background()
+
+	missing := filepath.Join(dir, "missing")
+	if _, err := lockBackupDir(ctx, missing, 0); !errors.IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+
+	loader := newFakeLoader(t, dir, "")
+	loader.SetSourceDirectory(missing)
+	if err := loader.Load(); !errors.IsNotFound(err) {
+		t.Errorf("expected not found, got %v", err)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("missing backup directory was created")
+	}
+
+	if !isReadOnly(errors.Trace(&os.PathError{Op: "open", Path: dir, Err: syscall.EROFS})) {
+		t.Errorf("EROFS is not read-only")
+	}
+	if isReadOnly(&os.PathError{Op: "open", Path: dir, Err: syscall.ENOSPC}) {
+		t.Errorf("ENOSPC is read-only")
+	}
+
+	readonly := filepath.Join(dir, "readonly")
+	if err := os.Mkdir(readonly, 0555); err != nil {
+		t.Fatal(err)
+	}
+	if f, err := os.Create(filepath.Join(readonly, "probe")); err == nil {
+		f.Close()
+		t.Skip("directory permissions are not enforced")
+	}
+	lock, err := lockBackupDir(ctx, readonly, 0)
+	if err != nil || lock != nil {
+		t.Errorf("expected no lock in a read-only directory, got %v, %v", lock, err)
+	}
+}
+
+func TestDumpLocked(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	outdir := filepath.Join(dir, "backup")
+	dumper := newFakeDumper(t, dir, "touch "+dir+"/executed")
+	dumper.SetOutPutDir(outdir)
+
+	lock, err := lockDir(context.Background(), outdir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = dumper.Dump()
+	lock.unlock()
+
+	if !IsDirectoryLocked(err) {
+		t.Fatalf("expected directory locked, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "executed")); !os.IsNotExist(err) {
+		t.Errorf("mydumper ran in a locked directory")
+	}
+
+	if err := dumper.Dump(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(outdir, LockFileName)); err != nil {
+		t.Errorf("lock file is missing: %v", err)
+	}
+}
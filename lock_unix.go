@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package mydumper
+
+import (
+	"os"
+	"syscall"
+)
+
+// the lock file can be removed with the rest of the directory while locked.
+const lockRemovableWhileOpen = true
+
+// take an exclusive flock on fd without blocking, the kernel releases it
+// when its holder dies.
+func lockFile(fd *os.File) error {
+	err := syscall.Flock(int(fd.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		return errLockBusy
+	}
+	return err
+}
+
+func unlockFile(fd *os.File) error {
+	return syscall.Flock(int(fd.Fd()), syscall.LOCK_UN)
+}
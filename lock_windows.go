@@ -0,0 +1,33 @@
+//go:build windows
+// +build windows
+
+package mydumper
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// an open file cannot be removed, the lock file is closed last.
+const lockRemovableWhileOpen = false
+
+// the locked byte lies past the recorded pid, LockFileEx locks are mandatory
+// and would keep other processes from reading it.
+var lockRange = windows.Overlapped{OffsetHigh: 1}
+
+// take an exclusive LockFileEx lock on fd without blocking, the system
+// releases it when its holder dies.
+func lockFile(fd *os.File) error {
+	ol := lockRange
+	err := windows.LockFileEx(windows.Handle(fd.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &ol)
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return errLockBusy
+	}
+	return err
+}
+
+func unlockFile(fd *os.File) error {
+	ol := lockRange
+	return windows.UnlockFileEx(windows.Handle(fd.Fd()), 0, 1, 0, &ol)
+}
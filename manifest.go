@@ -0,0 +1,222 @@
+package mydumper
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// name of the manifest file in a backup directory.
+const ManifestName = "manifest.json"
+
+type (
+	// checksum of one backup file.
+	ManifestFile struct {
+		Name   string `json:"name"`
+		Size   uint64 `json:"size"`
+		SHA256 string `json:"sha256"`
+	}
+
+	// checksums of every file of a backup, written by WriteManifest.
+	Manifest struct {
+		Created time.Time `json:"created"`
+		// sorted by name.
+		Files []ManifestFile `json:"files"`
+	}
+
+	// result of Verify, file names per problem.
+	VerifyReport struct {
+		Dir string `json:"dir"`
+		// files of the manifest that were checked.
+		Checked int `json:"checked"`
+		// in the manifest, not in the directory.
+		Missing []string `json:"missing"`
+		// in the directory, not in the manifest.
+		Extra []string `json:"extra"`
+		// checksum mismatch or a damaged gzip stream.
+		Corrupted []string `json:"corrupted"`
+		// shorter than recorded or a gzip stream without its trailer.
+		Truncated []string `json:"truncated"`
+	}
+)
+
+// files a manifest covers: regular files except the manifest itself and
+// the temporary files of writeFileAtomic.
+func manifestFiles(dir string) ([]os.FileInfo, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	files := make([]os.FileInfo, 0, len(infos))
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || info.Name() == ManifestName || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		files = append(files, info)
+	}
+	return files, nil
+}
+
+// hash every file in dir and write them to the manifest file, replacing it.
+func WriteManifest(dir string) (*Manifest, error) {
+	infos, err := manifestFiles(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	m := new(Manifest)
+	m.Created = time.Now()
+	m.Files = make([]ManifestFile, 0, len(infos))
+	for _, info := range infos {
+		sum, size, err := hashFile(filepath.Join(dir, info.Name()), false)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		m.Files = append(m.Files, ManifestFile{Name: info.Name(), Size: size, SHA256: sum})
+	}
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Name < m.Files[j].Name
+	})
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := writeFileAtomic(dir, ManifestName, append(data, '\n')); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return m, nil
+}
+
+// read the manifest file of dir.
+func ReadManifest(dir string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, ManifestName))
+	if os.IsNotExist(err) {
+		return nil, errors.NotFoundf("%s in %s", ManifestName, dir)
+	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	m := new(Manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, errors.Annotatef(err, "parse %s", ManifestName)
+	}
+	return m, nil
+}
+
+// sha256 and size of path. with inflate a gzip file is also fully
+// decompressed, so a damaged or truncated stream returns its gzip error.
+func hashFile(path string, inflate bool) (string, uint64, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", 0, errors.Trace(err)
+	}
+	defer fd.Close()
+
+	h := sha256.New()
+	r := io.TeeReader(fd, h)
+
+	var streamErr error
+	if inflate {
+		streamErr = checkGzip(r)
+	}
+	// hash what the gzip reader left unread.
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		return "", 0, errors.Trace(err)
+	}
+
+	info, err := fd.Stat()
+	if err != nil {
+		return "", 0, errors.Trace(err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), uint64(info.Size()), streamErr
+}
+
+func checkGzip(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	_, err = io.Copy(ioutil.Discard, gz)
+	return err
+}
+
+// check the files of dir against its manifest. gzip files are fully
+// decompressed to check their trailers. an error is only returned when the
+// manifest or directory cannot be read.
+func Verify(dir string) (*VerifyReport, error) {
+	m, err := ReadManifest(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	infos, err := manifestFiles(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	report := &VerifyReport{
+		Dir:       dir,
+		Missing:   make([]string, 0),
+		Extra:     make([]string, 0),
+		Corrupted: make([]string, 0),
+		Truncated: make([]string, 0),
+	}
+
+	present := make(map[string]bool, len(infos))
+	for _, info := range infos {
+		present[info.Name()] = true
+	}
+	recorded := make(map[string]bool, len(m.Files))
+
+	for _, f := range m.Files {
+		recorded[f.Name] = true
+		if !present[f.Name] {
+			report.Missing = append(report.Missing, f.Name)
+			continue
+		}
+		report.Checked++
+
+		sum, size, err := hashFile(filepath.Join(dir, f.Name), strings.HasSuffix(f.Name, ".gz"))
+		cause := errors.Cause(err)
+		_, deflate := cause.(flate.CorruptInputError)
+		switch {
+		case cause == io.EOF || cause == io.ErrUnexpectedEOF:
+			report.Truncated = append(report.Truncated, f.Name)
+		case cause == gzip.ErrChecksum || cause == gzip.ErrHeader || deflate:
+			report.Corrupted = append(report.Corrupted, f.Name)
+		case err != nil:
+			return nil, errors.Annotatef(err, "verify %s", f.Name)
+		case size < f.Size:
+			report.Truncated = append(report.Truncated, f.Name)
+		case sum != f.SHA256:
+			report.Corrupted = append(report.Corrupted, f.Name)
+		}
+	}
+
+	for _, info := range infos {
+		if !recorded[info.Name()] {
+			report.Extra = append(report.Extra, info.Name())
+		}
+	}
+	return report, nil
+}
+
+// no file is missing, extra, corrupted or truncated.
+func (r *VerifyReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Corrupted) == 0 && len(r.Truncated) == 0
+}
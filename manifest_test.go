@@ -0,0 +1,183 @@
+package mydumper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+)
+
+func gzipData(t *testing.T, data string) []byte {
+	buf := new(bytes.Buffer)
+	gz := gzip.NewWriter(buf)
+	if _, err := gz.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerify(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := Verify(dir); !errors.IsNotFound(err) {
+		t.Errorf("expected not found without manifest, got %v", err)
+	}
+
+	rows := bytes.Repeat([]byte("INSERT INTO t1 VALUES (1);\n"), 100)
+	files := map[string][]byte{
+		"metadata":            []byte("Started dump at: 2019-01-01 10:00:00\n"),
+		"dev.t1-schema.sql":   []byte("CREATE TABLE t1 (id int);"),
+		"dev.t1.00000.sql.gz": gzipData(t, string(rows)),
+		"dev.t1.00001.sql.gz": gzipData(t, string(rows)),
+		"dev.t1.00002.sql.gz": gzipData(t, string(rows)),
+		"dev.t2.sql":          rows,
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := WriteManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != len(files) || m.Files[0].Name != "dev.t1-schema.sql" {
+		t.Fatalf("unexpected manifest %+v", m)
+	}
+
+	report, err := Verify(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Checked != len(files) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	write := func(name string, data []byte) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// cut the gzip trailer.
+	gz := files["dev.t1.00000.sql.gz"]
+	write("dev.t1.00000.sql.gz", gz[:len(gz)-8])
+	// same size, damaged CRC.
+	gz = append([]byte(nil), files["dev.t1.00001.sql.gz"]...)
+	gz[len(gz)-8] ^= 0xff
+	write("dev.t1.00001.sql.gz", gz)
+	// same size, different content.
+	write("dev.t1-schema.sql", []byte("CREATE TABLE t1 (id INT);"))
+	// plain file cut short.
+	write("dev.t2.sql", rows[:10])
+	write("dev.t3.sql", rows)
+	if err := os.Remove(filepath.Join(dir, "metadata")); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = Verify(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &VerifyReport{
+		Dir:       dir,
+		Checked:   len(files) - 1,
+		Missing:   []string{"metadata"},
+		Extra:     []string{"dev.t3.sql"},
+		Corrupted: []string{"dev.t1-schema.sql", "dev.t1.00001.sql.gz"},
+		Truncated: []string{"dev.t1.00000.sql.gz", "dev.t2.sql"},
+	}
+	if report.OK() || !sameStrings(report.Missing, expected.Missing) || !sameStrings(report.Extra, expected.Extra) ||
+		!sameStrings(report.Corrupted, expected.Corrupted) || !sameStrings(report.Truncated, expected.Truncated) ||
+		report.Checked != expected.Checked {
+		t.Errorf("expected %+v, got %+v", expected, report)
+	}
+}
+
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDumpManifest(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	outdir := filepath.Join(dir, "backup")
+	if err := os.Mkdir(outdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dumper := newFakeDumper(t, dir, "echo 'INSERT INTO t1 VALUES (1);' > "+outdir+"/dev.t1.sql")
+	dumper.SetOutPutDir(outdir)
+	dumper.SetManifest(true)
+
+	if err := dumper.Dump(); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ReadManifest(outdir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Files) != 1 || m.Files[0].Name != "dev.t1.sql" || m.Files[0].Size != 27 {
+		t.Errorf("unexpected manifest %+v", m)
+	}
+	if b, err := ScanBackup(outdir); err != nil || b.FilesOf(FileManifest)[0].Name != ManifestName {
+		t.Errorf("manifest not classified: %v", err)
+	}
+}
+
+func TestDumpManifestWarning(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	outdir := filepath.Join(dir, "backup")
+	if err := os.Mkdir(outdir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// a directory in the way of manifest.json fails the rename.
+	dumper := newFakeDumper(t, dir, "echo 'INSERT INTO t1 VALUES (1);' > "+outdir+"/dev.t1.sql; mkdir -p "+outdir+"/"+ManifestName+"/x")
+	dumper.SetOutPutDir(outdir)
+	dumper.SetManifest(true)
+
+	var warning string
+	dumper.SetEventHandler(EventHandlerFunc(func(e Event) {
+		if e.Level == LevelWarning {
+			warning = e.Message
+		}
+	}))
+
+	if err := dumper.Dump(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(warning, "manifest") {
+		t.Errorf("expected a warning about the manifest, got %q", warning)
+	}
+	if _, err := os.Stat(filepath.Join(outdir, "dev.t1.sql")); err != nil {
+		t.Errorf("dump removed: %v", err)
+	}
+}
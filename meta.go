@@ -4,7 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -19,10 +22,68 @@ type (
 		BinLogFileName string    `json:"log_filename" db:"log_filename"`
 		BinLogFilePos  uint64    `json:"log_pos" db:"log_pos"`
 		BinLogUuid     string    `json:"log_uuid" db:"log_uuid"`
-		EndTimestamp   time.Time `json:"start_timestamp" db:"start_timestamp"`
+		EndTimestamp   time.Time `json:"end_timestamp" db:"end_timestamp"`
+		// session character set and collation of the dump, recorded by Dumper.
+		Charset   string `json:"charset" db:"charset"`
+		Collation string `json:"collation" db:"collation"`
+
+		// MetadataLegacy or MetadataINI.
+		Format string `json:"format" db:"format"`
+		// SHOW MASTER STATUS of the dumped server, nil when not recorded.
+		Master *MasterStatus `json:"master,omitempty" db:"-"`
+		// SHOW SLAVE STATUS of the dumped server, one per replication channel.
+		Replicas []ReplicaStatus `json:"replicas,omitempty" db:"-"`
+		// "Finished dump at" was present, mydumper completed the dump.
+		Completed bool `json:"completed" db:"completed"`
+
+		// return an error for malformed timestamps and positions instead of
+		// leaving them zero.
+		Strict bool `json:"-" db:"-"`
+		// time zone of the timestamps in the file. default time.Local
+		Location *time.Location `json:"-" db:"-"`
+
+		// sections of the INI file in order, the ones not parsed are kept
+		// verbatim and written back by WriteMetadata.
+		sections []metaSection
+		// the [master] section had a Channel_Name comment.
+		masterChannel bool
+	}
+
+	// a section of an INI metadata file, lines is nil for the sections
+	// formatINI generates from the parsed fields.
+	metaSection struct {
+		name  string
+		lines []string
+	}
+
+	// binlog position of the dumped server.
+	MasterStatus struct {
+		Log  string `json:"log"`
+		Pos  uint64 `json:"pos"`
+		GTID string `json:"gtid"`
+	}
+
+	// position the dumped replica had reached on its source.
+	ReplicaStatus struct {
+		Channel string `json:"channel"`
+		Host    string `json:"host"`
+		Log     string `json:"log"`
+		Pos     uint64 `json:"pos"`
+		GTID    string `json:"gtid"`
 	}
 )
 
+// metadata file formats.
+const (
+	// "SHOW MASTER STATUS:" blocks, written up to mydumper 0.10.
+	MetadataLegacy = "legacy"
+	// "[master]" sections, written by mydumper 0.11 and later.
+	MetadataINI = "ini"
+)
+
+// section holding the character set in INI style metadata files.
+const charsetSection = "go-mydumper"
+
 // new metadata
 func NewMeta(dir string) (*MetaData, error) {
 	m := new(MetaData)
@@ -31,14 +92,23 @@ func NewMeta(dir string) (*MetaData, error) {
 	m.BinLogFileName = "archlog.000001"
 	m.BinLogFilePos = 0
 	m.BinLogUuid = ""
+	m.Location = time.Local
 
 	return m, nil
 }
 
+// enable/disable strict parsing
+func (m *MetaData) SetStrict(strict bool) {
+	m.Strict = strict
+}
+
+// set time zone of the timestamps
+func (m *MetaData) SetLocation(loc *time.Location) {
+	m.Location = loc
+}
+
 // read metadata file
 func (m *MetaData) ReadMetadata() error {
-	// new buffer
-	buf := new(bytes.Buffer)
 
 	// metadata file name.
 	meta := fmt.Sprintf("%s/metadata", m.MetaDir)
@@ -50,43 +120,473 @@ func (m *MetaData) ReadMetadata() error {
 	}
 	defer MetaFd.Close()
 
-	MetaRd := bufio.NewReader(MetaFd)
-	for {
-		line, err := MetaRd.ReadBytes('\n')
-		if err != nil {
+	return errors.Trace(m.parse(MetaFd))
+}
+
+// parse a metadata file in either format.
+func (m *MetaData) parse(r io.Reader) error {
+	lines := make([]string, 0, 16)
+
+	scanner := bufio.NewScanner(r)
+	// GTID sets of servers with many sources can be long.
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Trace(err)
+	}
+
+	m.Master = nil
+	m.Replicas = nil
+	m.Completed = false
+	m.sections = nil
+	m.masterChannel = false
+
+	m.Format = MetadataLegacy
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			m.Format = MetadataINI
 			break
 		}
+	}
+
+	var err error
+	if m.Format == MetadataINI {
+		err = m.parseINI(lines)
+	} else {
+		err = m.parseLegacy(lines)
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if m.Master != nil {
+		m.BinLogFileName = m.Master.Log
+		m.BinLogFilePos = m.Master.Pos
+		m.BinLogUuid = m.Master.GTID
+	}
+	return nil
+}
+
+// parse the format written up to mydumper 0.10:
+//
+//	Started dump at: 2019-01-01 10:00:00
+//	SHOW MASTER STATUS:
+//		Log: mysql-bin.000003
+//		Pos: 154
+//		GTID:3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5
+//
+//	SHOW SLAVE STATUS:
+//		Host: 10.0.0.1
+//		...
+//	Finished dump at: 2019-01-01 10:00:10
+func (m *MetaData) parseLegacy(lines []string) error {
+	var master *MasterStatus
+	var replica *ReplicaStatus
+	lastKey := ""
+
+	for n, line := range lines {
+		var err error
+		trimmed := strings.TrimSpace(line)
+		indented := len(line) > 0 && (line[0] == '\t' || line[0] == ' ')
+
+		// GTID sets continue unindented after a trailing comma.
+		if !indented && len(trimmed) > 0 && lastKey == "GTID" && (master != nil || replica != nil) && !strings.Contains(trimmed, ": ") {
+			if master != nil {
+				master.GTID += trimmed
+			} else {
+				replica.GTID += trimmed
+			}
+			continue
+		}
+		lastKey = ""
 
-		if len(line) > 2 {
-			newline := bytes.TrimLeft(line, "")
-			buf.Write(bytes.Trim(newline, "\n"))
-			line = []byte{}
+		switch {
+		case len(trimmed) == 0:
+			master, replica = nil, nil
+		case strings.HasPrefix(trimmed, "Started dump at:"):
+			m.StartTimestamp, err = m.parseTime(metaValue(trimmed, ":"))
+		case strings.HasPrefix(trimmed, "Finished dump at:"):
+			m.Completed = true
+			m.EndTimestamp, err = m.parseTime(metaValue(trimmed, ":"))
+		case strings.HasPrefix(trimmed, "Character set:"):
+			m.Charset = metaValue(trimmed, ":")
+		case strings.HasPrefix(trimmed, "Collation:"):
+			m.Collation = metaValue(trimmed, ":")
+		case trimmed == "SHOW MASTER STATUS:":
+			m.Master = new(MasterStatus)
+			master, replica = m.Master, nil
+		case trimmed == "SHOW SLAVE STATUS:":
+			m.Replicas = append(m.Replicas, ReplicaStatus{})
+			master, replica = nil, &m.Replicas[len(m.Replicas)-1]
+		case master != nil || replica != nil:
+			key := strings.TrimSpace(strings.SplitN(trimmed, ":", 2)[0])
+			value := metaValue(trimmed, ":")
+			if master != nil {
+				lastKey, err = master.set(key, value)
+			} else {
+				lastKey, err = replica.set(key, value)
+			}
 		}
-		if strings.Contains(string(buf.Bytes()), "Started") == true {
-			splitbuf := strings.Split(string(buf.Bytes()), ":")
-			m.StartTimestamp, _ = time.ParseInLocation("2006-01-02 15:04:05", strings.TrimLeft(strings.Join(splitbuf[1:], ":"), " "), time.Local)
+
+		if err != nil && m.Strict {
+			return errors.Annotatef(err, "metadata line %d", n+1)
 		}
-		if strings.Contains(string(buf.Bytes()), "Log") == true {
-			splitbuf := strings.Split(string(buf.Bytes()), ":")
-			m.BinLogFileName = strings.TrimLeft(strings.Join(splitbuf[1:], ":"), " ")
+	}
+	return nil
+}
+
+// parse the format written by mydumper 0.11 and later:
+//
+//	# Started dump at: 2022-10-01 10:00:00
+//	[master]
+//	# Channel_Name = '' # It can be use to setup replication FOR CHANNEL
+//	File = mysql-bin.000003
+//	Position = 1549
+//	Executed_Gtid_Set = 3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5
+//
+//	[replication]
+//	...
+//	# Finished dump at: 2022-10-01 10:00:05
+func (m *MetaData) parseINI(lines []string) error {
+	section := ""
+	var master *MasterStatus
+	var replica *ReplicaStatus
+	var raw *metaSection
+	lastKey := ""
+
+	for n, line := range lines {
+		var err error
+		trimmed := strings.TrimSpace(line)
+
+		if len(trimmed) > 0 && !strings.Contains(trimmed, "=") && !strings.HasPrefix(trimmed, "#") &&
+			!strings.HasPrefix(trimmed, "[") && lastKey == "GTID" && (master != nil || replica != nil) {
+			if master != nil {
+				master.GTID += trimmed
+			} else {
+				replica.GTID += trimmed
+			}
+			continue
 		}
-		if strings.Contains(string(buf.Bytes()), "Pos") == true {
-			splitbuf := strings.Split(string(buf.Bytes()), ":")
-			pos, _ := strconv.Atoi(strings.TrimLeft(strings.Join(splitbuf[1:], ":"), " "))
+		lastKey = ""
 
-			m.BinLogFilePos = uint64(pos)
+		if raw != nil && !strings.HasPrefix(trimmed, "[") && !isDumpTimeComment(trimmed) {
+			raw.lines = append(raw.lines, line)
+			continue
 		}
 
-		if strings.Contains(string(buf.Bytes()), "GTID") == true {
-			splitbuf := strings.Split(string(buf.Bytes()), ":")
-			m.BinLogUuid = strings.TrimLeft(strings.Join(splitbuf[1:], ":"), " ")
+		switch {
+		case len(trimmed) == 0:
+		case strings.HasPrefix(trimmed, "#"):
+			comment := strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+			switch {
+			case strings.HasPrefix(comment, "Started dump at:"):
+				m.StartTimestamp, err = m.parseTime(metaValue(comment, ":"))
+			case strings.HasPrefix(comment, "Finished dump at:"):
+				m.Completed = true
+				m.EndTimestamp, err = m.parseTime(metaValue(comment, ":"))
+			case strings.HasPrefix(comment, "Channel_Name") && strings.Contains(comment, "=") && replica != nil:
+				// "# Channel_Name = 'ch1' # It can be use to setup replication FOR CHANNEL"
+				value := strings.SplitN(strings.SplitN(comment, "=", 2)[1], "#", 2)[0]
+				replica.set("Channel_Name", unquoteMeta(strings.TrimSpace(value)))
+			case strings.HasPrefix(comment, "Channel_Name") && master != nil:
+				m.masterChannel = true
+			}
+		case strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]"):
+			section = strings.ToLower(strings.Trim(trimmed, "[]"))
+			master, replica, raw = nil, nil, nil
+			switch section {
+			case "master", "source":
+				m.Master = new(MasterStatus)
+				master = m.Master
+				m.sections = append(m.sections, metaSection{name: "master"})
+			case "replication", "replica", "slave":
+				m.Replicas = append(m.Replicas, ReplicaStatus{})
+				replica = &m.Replicas[len(m.Replicas)-1]
+				m.sections = append(m.sections, metaSection{name: "replication"})
+			case charsetSection:
+				m.sections = append(m.sections, metaSection{name: charsetSection})
+			default:
+				m.sections = append(m.sections, metaSection{name: section, lines: []string{line}})
+				raw = &m.sections[len(m.sections)-1]
+			}
+		default:
+			key := strings.TrimSpace(strings.SplitN(trimmed, "=", 2)[0])
+			value := metaValue(trimmed, "=")
+			switch {
+			case master != nil:
+				lastKey, err = master.set(key, value)
+			case replica != nil:
+				lastKey, err = replica.set(key, value)
+			case section == charsetSection && key == "charset":
+				m.Charset = value
+			case section == charsetSection && key == "collation":
+				m.Collation = value
+			}
 		}
-		if strings.Contains(string(buf.Bytes()), "Finished") == true {
-			splitbuf := strings.Split(string(buf.Bytes()), ":")
-			m.EndTimestamp, _ = time.ParseInLocation("2006-01-02 15:04:05", strings.TrimLeft(strings.Join(splitbuf[1:], ":"), " "), time.Local)
+
+		if err != nil && m.Strict {
+			return errors.Annotatef(err, "metadata line %d", n+1)
 		}
-		buf.Reset()
 	}
-
 	return nil
 }
+
+// "# Started dump at" or "# Finished dump at", rewritten from the timestamps.
+func isDumpTimeComment(trimmed string) bool {
+	comment := strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+	return strings.HasPrefix(trimmed, "#") &&
+		(strings.HasPrefix(comment, "Started dump at:") || strings.HasPrefix(comment, "Finished dump at:"))
+}
+
+// set a field from its key in either format, returns the normalized key.
+func (s *MasterStatus) set(key string, value string) (string, error) {
+	var err error
+	switch key {
+	case "Log", "File", "SOURCE_LOG_FILE":
+		s.Log = value
+		return "Log", nil
+	case "Pos", "Position", "SOURCE_LOG_POS":
+		s.Pos, err = parsePos(value)
+		return "Pos", err
+	case "GTID", "Executed_Gtid_Set":
+		s.GTID = value
+		return "GTID", nil
+	}
+	return key, nil
+}
+
+// set a field from its key in either format, returns the normalized key.
+func (s *ReplicaStatus) set(key string, value string) (string, error) {
+	var err error
+	switch key {
+	case "Connection name", "Channel_Name", "Channel Name":
+		s.Channel = value
+		return "Channel", nil
+	case "Host", "Master_Host", "SOURCE_HOST":
+		s.Host = value
+		return "Host", nil
+	case "Log", "File", "Relay_Master_Log_File", "SOURCE_LOG_FILE":
+		s.Log = value
+		return "Log", nil
+	case "Pos", "Position", "Exec_Master_Log_Pos", "SOURCE_LOG_POS":
+		s.Pos, err = parsePos(value)
+		return "Pos", err
+	case "GTID", "Executed_Gtid_Set":
+		s.GTID = value
+		return "GTID", nil
+	}
+	return key, nil
+}
+
+func parsePos(value string) (uint64, error) {
+	pos, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, errors.NotValidf("position %q", value)
+	}
+	return pos, nil
+}
+
+// value after the first sep, trimmed and unquoted.
+func metaValue(line string, sep string) string {
+	parts := strings.SplitN(line, sep, 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return unquoteMeta(strings.TrimSpace(parts[1]))
+}
+
+// strip single or double quotes around value.
+func unquoteMeta(value string) string {
+	if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// parse a timestamp in Location. a malformed one is returned as zero time with an error.
+func (m *MetaData) parseTime(value string) (time.Time, error) {
+	loc := m.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", value, loc)
+	if err != nil {
+		return time.Time{}, errors.NotValidf("timestamp %q", value)
+	}
+	return t, nil
+}
+
+// write the metadata file in MetaDir, in Format. the file is replaced atomically.
+func (m *MetaData) WriteMetadata() error {
+	buf := new(bytes.Buffer)
+
+	if m.Format == MetadataINI {
+		m.formatINI(buf)
+	} else {
+		m.formatLegacy(buf)
+	}
+
+	return errors.Trace(writeFileAtomic(m.MetaDir, "metadata", buf.Bytes()))
+}
+
+// replace dir/name with data through a temporary file and a rename.
+func writeFileAtomic(dir string, name string, data []byte) error {
+	fd, err := ioutil.TempFile(dir, "."+name+"-")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer os.Remove(fd.Name())
+
+	if _, err := fd.Write(data); err != nil {
+		fd.Close()
+		return errors.Trace(err)
+	}
+	if err := fd.Chmod(0644); err != nil {
+		fd.Close()
+		return errors.Trace(err)
+	}
+	if err := fd.Close(); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(os.Rename(fd.Name(), filepath.Join(dir, name)))
+}
+
+// master status to write, built from the BinLog fields when Master is nil.
+func (m *MetaData) masterStatus() *MasterStatus {
+	if m.Master != nil {
+		return m.Master
+	}
+	if len(m.BinLogFileName) == 0 {
+		return nil
+	}
+	return &MasterStatus{Log: m.BinLogFileName, Pos: m.BinLogFilePos, GTID: m.BinLogUuid}
+}
+
+func (m *MetaData) formatLegacy(buf *bytes.Buffer) {
+	if !m.StartTimestamp.IsZero() {
+		fmt.Fprintf(buf, "Started dump at: %s\n", m.StartTimestamp.Format("2006-01-02 15:04:05"))
+	}
+	if master := m.masterStatus(); master != nil {
+		fmt.Fprintf(buf, "SHOW MASTER STATUS:\n")
+		fmt.Fprintf(buf, "\tLog: %s\n\tPos: %d\n\tGTID:%s\n\n", master.Log, master.Pos, master.GTID)
+	}
+	for _, replica := range m.Replicas {
+		fmt.Fprintf(buf, "SHOW SLAVE STATUS:\n")
+		if len(replica.Channel) > 0 {
+			fmt.Fprintf(buf, "\tConnection name: %s\n", replica.Channel)
+		}
+		fmt.Fprintf(buf, "\tHost: %s\n\tLog: %s\n\tPos: %d\n\tGTID:%s\n\n", replica.Host, replica.Log, replica.Pos, replica.GTID)
+	}
+	if !m.EndTimestamp.IsZero() {
+		fmt.Fprintf(buf, "Finished dump at: %s\n", m.EndTimestamp.Format("2006-01-02 15:04:05"))
+	}
+	if len(m.Charset) > 0 || len(m.Collation) > 0 {
+		fmt.Fprintf(buf, "Character set: %s\nCollation: %s\n", m.Charset, m.Collation)
+	}
+}
+
+// write the parsed sections in the order they were read, followed by the
+// ones the file did not have.
+func (m *MetaData) formatINI(buf *bytes.Buffer) {
+	if !m.StartTimestamp.IsZero() {
+		fmt.Fprintf(buf, "# Started dump at: %s\n", m.StartTimestamp.Format("2006-01-02 15:04:05"))
+	}
+
+	written := make(map[string]bool)
+	blank := true
+	generate := func(name string) {
+		if written[name] {
+			return
+		}
+		written[name] = true
+		var section bytes.Buffer
+		switch name {
+		case "master":
+			if master := m.masterStatus(); master != nil {
+				fmt.Fprintf(&section, "[master]\n")
+				if m.masterChannel {
+					fmt.Fprintf(&section, "# Channel_Name = '' # It can be use to setup replication FOR CHANNEL\n")
+				}
+				fmt.Fprintf(&section, "File = %s\nPosition = %d\nExecuted_Gtid_Set = %s\n\n", master.Log, master.Pos, master.GTID)
+			}
+		case "replication":
+			for _, replica := range m.Replicas {
+				fmt.Fprintf(&section, "[replication]\n")
+				fmt.Fprintf(&section, "# Channel_Name = '%s' # It can be use to setup replication FOR CHANNEL\n", replica.Channel)
+				fmt.Fprintf(&section, "Host = %s\nFile = %s\nPosition = %d\nExecuted_Gtid_Set = %s\n\n", replica.Host, replica.Log, replica.Pos, replica.GTID)
+			}
+		case charsetSection:
+			if len(m.Charset) > 0 || len(m.Collation) > 0 {
+				fmt.Fprintf(&section, "[%s]\ncharset = %s\ncollation = %s\n\n", charsetSection, m.Charset, m.Collation)
+			}
+		}
+		if section.Len() == 0 {
+			return
+		}
+		if !blank {
+			// after a kept section without a trailing blank line.
+			buf.WriteString("\n")
+		}
+		buf.Write(section.Bytes())
+		blank = true
+	}
+
+	for _, section := range m.sections {
+		if section.lines == nil {
+			generate(section.name)
+			continue
+		}
+		for _, line := range section.lines {
+			fmt.Fprintf(buf, "%s\n", line)
+		}
+		blank = len(strings.TrimSpace(section.lines[len(section.lines)-1])) == 0
+	}
+	for _, name := range []string{"master", "replication", charsetSection} {
+		generate(name)
+	}
+
+	if !m.EndTimestamp.IsZero() {
+		fmt.Fprintf(buf, "# Finished dump at: %s\n", m.EndTimestamp.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// append the character set and collation to the metadata file in dir,
+// as a section when mydumper wrote an INI style file.
+func writeCharsetMetadata(dir string, charset string, collation string) error {
+	meta := fmt.Sprintf("%s/metadata", dir)
+
+	content, err := ioutil.ReadFile(meta)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	ini := false
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "[") {
+			ini = true
+			break
+		}
+	}
+
+	var record string
+	if ini {
+		record = fmt.Sprintf("\n[%s]\ncharset = %s\ncollation = %s\n", charsetSection, charset, collation)
+	} else {
+		record = fmt.Sprintf("Character set: %s\nCollation: %s\n", charset, collation)
+	}
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		record = "\n" + record
+	}
+
+	MetaFd, err := os.OpenFile(meta, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer MetaFd.Close()
+
+	_, err = MetaFd.WriteString(record)
+	return errors.Trace(err)
+}
@@ -0,0 +1,191 @@
+package mydumper
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readTestMetadata(t *testing.T, dir string) *MetaData {
+	meta, err := NewMeta(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := meta.ReadMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	return meta
+}
+
+func TestReadLegacyMetadata(t *testing.T) {
+
+	meta := readTestMetadata(t, "testdata/legacy")
+
+	if meta.Format != MetadataLegacy {
+		t.Errorf("unexpected format %s", meta.Format)
+	}
+	if !meta.StartTimestamp.Equal(time.Date(2019, 1, 1, 10, 0, 0, 0, time.Local)) || !meta.EndTimestamp.Equal(time.Date(2019, 1, 1, 10, 0, 10, 0, time.Local)) {
+		t.Errorf("unexpected timestamps %s, %s", meta.StartTimestamp, meta.EndTimestamp)
+	}
+
+	expected := MasterStatus{Log: "mysql-bin.000003", Pos: 154, GTID: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"}
+	if meta.Master == nil || *meta.Master != expected {
+		t.Errorf("unexpected master status %+v", meta.Master)
+	}
+	if meta.BinLogFileName != expected.Log || meta.BinLogFilePos != expected.Pos || meta.BinLogUuid != expected.GTID {
+		t.Errorf("binlog fields not taken from master status: %+v", meta)
+	}
+
+	replica := ReplicaStatus{Host: "10.0.0.1", Log: "mysql-bin.000010", Pos: 1234, GTID: "2174b383-5441-11e8-b90a-c80aa9429562:1-77"}
+	if len(meta.Replicas) != 1 || meta.Replicas[0] != replica {
+		t.Errorf("unexpected replica status %+v", meta.Replicas)
+	}
+}
+
+func TestReadMultiSourceMetadata(t *testing.T) {
+
+	meta := readTestMetadata(t, "testdata/multisource")
+
+	if meta.Master == nil || meta.Master.GTID != "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5,2174b383-5441-11e8-b90a-c80aa9429562:1-77" {
+		t.Errorf("multi-line GTID not joined: %+v", meta.Master)
+	}
+	if len(meta.Replicas) != 2 || meta.Replicas[0].Channel != "ch1" || meta.Replicas[1].Channel != "ch2" || meta.Replicas[1].Pos != 4 {
+		t.Errorf("unexpected replica status %+v", meta.Replicas)
+	}
+	// the file has no trailing newline.
+	if meta.EndTimestamp.IsZero() {
+		t.Errorf("last line was not parsed")
+	}
+}
+
+func TestReadINIMetadata(t *testing.T) {
+
+	meta := readTestMetadata(t, "testdata/ini")
+
+	if meta.Format != MetadataINI {
+		t.Errorf("unexpected format %s", meta.Format)
+	}
+	if !meta.StartTimestamp.Equal(time.Date(2022, 10, 1, 10, 0, 0, 0, time.Local)) || !meta.EndTimestamp.Equal(time.Date(2022, 10, 1, 10, 0, 5, 0, time.Local)) {
+		t.Errorf("unexpected timestamps %s, %s", meta.StartTimestamp, meta.EndTimestamp)
+	}
+
+	expected := MasterStatus{Log: "mysql-bin.000003", Pos: 1549, GTID: "3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"}
+	if meta.Master == nil || *meta.Master != expected {
+		t.Errorf("unexpected master status %+v", meta.Master)
+	}
+
+	replica := ReplicaStatus{Channel: "ch1", Host: "10.0.0.1", Log: "mysql-bin.000010", Pos: 1234, GTID: "2174b383-5441-11e8-b90a-c80aa9429562:1-77"}
+	if len(meta.Replicas) != 1 || meta.Replicas[0] != replica {
+		t.Errorf("unexpected replica status %+v", meta.Replicas)
+	}
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+
+	for _, golden := range []string{"testdata/golden/legacy", "testdata/golden/ini", "testdata/ini"} {
+		meta := readTestMetadata(t, golden)
+
+		dir, err := ioutil.TempDir("", "mydumper")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		meta.MetaDir = dir
+		if err := meta.WriteMetadata(); err != nil {
+			t.Fatal(err)
+		}
+
+		expected, err := ioutil.ReadFile(filepath.Join(golden, "metadata"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		written, err := ioutil.ReadFile(filepath.Join(dir, "metadata"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(expected, written) {
+			t.Errorf("%s: written metadata differs:\n%s", golden, written)
+		}
+	}
+}
+
+func TestMetadataJSON(t *testing.T) {
+
+	meta := readTestMetadata(t, "testdata/golden/legacy")
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := new(MetaData)
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !decoded.StartTimestamp.Equal(meta.StartTimestamp) || !decoded.EndTimestamp.Equal(meta.EndTimestamp) {
+		t.Errorf("timestamps lost: %s, %s", decoded.StartTimestamp, decoded.EndTimestamp)
+	}
+	if decoded.Master == nil || *decoded.Master != *meta.Master || len(decoded.Replicas) != 1 || decoded.Replicas[0] != meta.Replicas[0] {
+		t.Errorf("status lost: %s", data)
+	}
+}
+
+func TestStrictMetadata(t *testing.T) {
+
+	cases := map[string]string{
+		"Started dump at: 2019-01-01 10:00\nFinished dump at: 2019-01-01 10:00:01\n": "metadata line 1: timestamp \"2019-01-01 10:00\" not valid",
+		"SHOW MASTER STATUS:\n\tLog: mysql-bin.000003\n\tPos: 15x4\n":                "metadata line 3: position \"15x4\" not valid",
+		"[master]\nFile = mysql-bin.000003\nPosition = -1\n":                         "metadata line 3: position \"-1\" not valid",
+	}
+
+	for content, expected := range cases {
+		meta := new(MetaData)
+		meta.SetStrict(true)
+		err := meta.parse(strings.NewReader(content))
+		if err == nil || err.Error() != expected {
+			t.Errorf("%q: expected %q, got %v", content, expected, err)
+		}
+
+		meta.SetStrict(false)
+		if err := meta.parse(strings.NewReader(content)); err != nil {
+			t.Errorf("%q: lenient parsing failed: %s", content, err)
+		}
+	}
+}
+
+func TestMetadataCompleted(t *testing.T) {
+
+	meta := new(MetaData)
+	if err := meta.parse(strings.NewReader("Started dump at: 2019-01-01 10:00:00\nSHOW MASTER STATUS:\n\tLog: mysql-bin.000003\n")); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Completed {
+		t.Errorf("dump without Finished line reported as completed")
+	}
+
+	if err := meta.parse(strings.NewReader("Started dump at: 2019-01-01 10:00:00\nFinished dump at: 2019-01-01 10:00:01")); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.Completed {
+		t.Errorf("Finished line without trailing newline not seen")
+	}
+}
+
+func TestMetadataLocation(t *testing.T) {
+
+	meta := readTestMetadata(t, "testdata/legacy")
+	meta.SetLocation(time.UTC)
+	if err := meta.ReadMetadata(); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.StartTimestamp.Equal(time.Date(2019, 1, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("timestamp not parsed in UTC: %s", meta.StartTimestamp)
+	}
+}
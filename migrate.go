@@ -0,0 +1,145 @@
+package mydumper
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// catalog schema migrations, version n is migrations[n-1].
+// only append to this list, applied migrations must never change.
+var migrations = []string{
+	StmtSchema,
+	StmtSchemaV2,
+	StmtSchemaV3,
+	StmtSchemaV4,
+}
+
+// free form key/value pairs of a Recorder.
+type Labels map[string]string
+
+// store labels as a JSON object.
+func (l Labels) Value() (driver.Value, error) {
+	if l == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return string(data), nil
+}
+
+// read labels stored by Value.
+func (l *Labels) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return errors.NotValidf("labels of type %T", src)
+	}
+
+	labels := make(Labels)
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return errors.Trace(err)
+	}
+	if len(labels) == 0 {
+		labels = nil
+	}
+	*l = labels
+	return nil
+}
+
+func migrationChecksum(stmt string) string {
+	sum := sha256.Sum256([]byte(stmt))
+	return hex.EncodeToString(sum[:])
+}
+
+// bring db up to the last of steps, each pending step in its own transaction.
+// fails when an applied step no longer matches its checksum or db was
+// migrated by a newer version of this package.
+func migrate(db *sql.DB, steps []string) error {
+	if _, err := db.Exec(StmtSchemaVersion); err != nil {
+		return errors.Trace(err)
+	}
+
+	applied, err := schemaVersions(db)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if len(applied) > len(steps) {
+		return errors.NewNotSupported(nil, fmt.Sprintf("catalog schema version %d is newer than %d", len(applied), len(steps)))
+	}
+	for i, checksum := range applied {
+		if checksum != migrationChecksum(steps[i]) {
+			return errors.NewNotValid(nil, fmt.Sprintf("checksum of applied catalog migration %d does not match", i+1))
+		}
+	}
+
+	for i := len(applied); i < len(steps); i++ {
+		if err := applyMigration(db, i+1, steps[i]); err != nil {
+			return errors.Annotatef(err, "catalog migration %d", i+1)
+		}
+	}
+	return nil
+}
+
+// checksums of the applied migrations, in version order.
+func schemaVersions(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(StmtQuerySchemaVersion)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	checksums := make([]string, 0)
+	for rows.Next() {
+		var version int
+		var checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if version != len(checksums)+1 {
+			return nil, errors.NotValidf("catalog schema version %d after %d", version, len(checksums))
+		}
+		checksums = append(checksums, checksum)
+	}
+	return checksums, errors.Trace(rows.Err())
+}
+
+func applyMigration(db *sql.DB, version int, stmt string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(stmt); err != nil {
+		return errors.Trace(err)
+	}
+	if _, err := tx.Exec(StmtInsertSchemaVersion, version, migrationChecksum(stmt), time.Now().UTC()); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(tx.Commit())
+}
+
+// schema version of the catalog.
+func (c *Catalog) SchemaVersion() (int, error) {
+	applied, err := schemaVersions(c.db)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return len(applied), nil
+}
@@ -0,0 +1,124 @@
+package mydumper
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// t_data_backup as created by the first catalogs, kept literal so later
+// edits of StmtSchema cannot hide a broken upgrade.
+const catalogV1 = `
+CREATE TABLE IF NOT EXISTS t_data_backup (
+	id integer NOT NULL,
+	type int NOT NULL,
+	method int NOT NULL,
+	state int NOT NULL,
+	backup_dir varchar(1024) NOT NULL DEFAULT '/backup',
+	binlog_filename varchar(1024) NOT NULL DEFAULT 'archlog.000001',
+	binlog_filepos int NOT NULL,
+	binlog_uuid varchar(512),
+	start_timestamp datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	end_timestamp datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_data_backup_state ON t_data_backup (state);
+CREATE INDEX IF NOT EXISTS idx_data_backup_start ON t_data_backup (start_timestamp);
+`
+
+func TestCatalogMigrateFromV1(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "catalog.db")
+
+	// a catalog created before the schema was versioned.
+	db, err := sql.Open(CatalogDriver, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(catalogV1); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO t_data_backup(type,method,state,binlog_filepos,start_timestamp,end_timestamp) VALUES (0,0,2,154,?,?)`,
+		time.Now().UTC(), time.Now().UTC())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	c, err := NewCatalog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	version, err := c.SchemaVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Errorf("expected version %d, got %d", len(migrations), version)
+	}
+
+	got, err := c.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != StateSucceeded || got.BinLogFilePos != 154 || got.Size != 0 || got.Labels != nil {
+		t.Errorf("unexpected record %+v", got)
+	}
+
+	got.Size = 4096
+	got.ServerUuid = uuidA
+	got.MydumperVersion = "0.10.0"
+	got.Labels = Labels{"env": "prod"}
+	if err := c.Update(got); err != nil {
+		t.Fatal(err)
+	}
+	again, err := c.Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Size != 4096 || again.ServerUuid != uuidA || again.MydumperVersion != "0.10.0" || again.Labels["env"] != "prod" {
+		t.Errorf("unexpected record %+v", again)
+	}
+
+	failed := &Recorder{State: StateFailed, Message: "access denied"}
+	if err := c.Insert(failed); err != nil {
+		t.Fatal(err)
+	}
+	records, err := c.List(RecordFilter{States: []BackupState{StateFailed}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Message != "access denied" {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
+
+func TestCatalogMigrateChecks(t *testing.T) {
+	c, cleanup := newTestCatalog(t)
+	defer cleanup()
+
+	// reopening applies nothing.
+	if err := migrate(c.db, migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrate(c.db, migrations[:1]); !errors.IsNotSupported(err) {
+		t.Errorf("expected not supported for a newer catalog, got %v", err)
+	}
+
+	changed := []string{StmtSchema + "\n", StmtSchemaV2, StmtSchemaV3, StmtSchemaV4}
+	if err := migrate(c.db, changed); !errors.IsNotValid(err) {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+}
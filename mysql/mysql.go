@@ -0,0 +1,9 @@
+// Package mysql registers the MySQL driver Dumper uses to read table sizes
+// when tracking progress:
+//
+//	import _ "github.com/imSQL/go-mydumper/mysql"
+package mysql
+
+import (
+	_ "github.com/go-sql-driver/mysql"
+)
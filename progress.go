@@ -0,0 +1,348 @@
+package mydumper
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// how often the output directory is scanned while tracking progress.
+const progressInterval = time.Second
+
+// database/sql driver the table sizes are read with when Dumper.ProgressDB is
+// nil. it is registered by importing github.com/imSQL/go-mydumper/mysql.
+const ProgressDriver = "mysql"
+
+type (
+	// completion of a running dump.
+	Progress struct {
+		Started time.Time `json:"started"`
+		// expected data size from information_schema, 0 when unknown.
+		BytesExpected uint64 `json:"bytes_expected"`
+		// size of the data files in OutPutDir.
+		BytesWritten   uint64  `json:"bytes_written"`
+		TablesTotal    int     `json:"tables_total"`
+		TablesFinished int     `json:"tables_finished"`
+		Percent        float64 `json:"percent"`
+		// estimated remaining time, 0 when unknown.
+		ETA  time.Duration `json:"eta"`
+		Done bool          `json:"done"`
+	}
+
+	// expected and written work of a table.
+	tableProgress struct {
+		expected uint64
+		written  uint64
+		finished bool
+	}
+
+	// tracks a dump, fed by its output lines and by scanning OutPutDir.
+	progressTracker struct {
+		mu      sync.Mutex
+		dir     string
+		next    EventHandler
+		events  *eventDispatcher
+		started time.Time
+		tables  map[string]*tableProgress
+		// table each thread is currently dumping.
+		threads map[int]string
+		done    bool
+
+		stop    chan struct{}
+		stopped chan struct{}
+		// reads the expected table sizes, see loadSizes.
+		sizes       func(ctx context.Context) (map[string]uint64, error)
+		ctx         context.Context
+		cancelSizes context.CancelFunc
+		sized       chan struct{}
+	}
+)
+
+// new tracker for d writing to dir. expected work is read from information_schema
+// while the dump runs, when the server cannot be queried only the written bytes
+// are tracked.
+func newProgressTracker(ctx context.Context, d *Dumper, dir string, next EventHandler) *progressTracker {
+	p := new(progressTracker)
+	p.dir = dir
+	p.next = next
+	p.started = time.Now()
+	p.tables = make(map[string]*tableProgress)
+	p.threads = make(map[int]string)
+	p.sizes = d.tableSizes
+	p.ctx = ctx
+	return p
+}
+
+// fill in the expected size of every table.
+func (p *progressTracker) loadSizes(ctx context.Context) {
+	defer close(p.sized)
+
+	sizes, err := p.sizes(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			p.events.warn(fmt.Sprintf("progress: cannot read table sizes: %s", err))
+		}
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, size := range sizes {
+		t, ok := p.tables[name]
+		if !ok {
+			t = new(tableProgress)
+			p.tables[name] = t
+		}
+		t.expected = size
+	}
+}
+
+// query the data size of every table selected by Databases, Tables and Regex.
+func (d *Dumper) tableSizes(ctx context.Context) (map[string]uint64, error) {
+	match := func(string) bool { return true }
+	if len(d.Regex) > 0 {
+		var err error
+		match, err = compileRegex(d.Regex)
+		if err != nil {
+			return nil, errors.Annotate(err, "regex cannot be emulated in Go")
+		}
+	}
+
+	db := d.ProgressDB
+	if db == nil {
+		if !driverRegistered(ProgressDriver) {
+			return nil, errors.NewNotSupported(nil, "table sizes without the "+ProgressDriver+
+				" driver, import github.com/imSQL/go-mydumper/mysql or set ProgressDB")
+		}
+		addr := net.JoinHostPort(d.Addr, strconv.FormatUint(d.Port, 10))
+		dsn := fmt.Sprintf("%s:%s@tcp(%s)/information_schema?timeout=10s", d.User, d.Password, addr)
+
+		var err error
+		if db, err = sql.Open(ProgressDriver, dsn); err != nil {
+			return nil, errors.Trace(err)
+		}
+		defer db.Close()
+	}
+
+	rows, err := db.QueryContext(ctx, `
+	SELECT
+		TABLE_SCHEMA,TABLE_NAME,IFNULL(DATA_LENGTH,0)
+	FROM
+		information_schema.TABLES
+	WHERE
+		TABLE_TYPE = 'BASE TABLE' AND TABLE_SCHEMA NOT IN ('information_schema','performance_schema')
+	`)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer rows.Close()
+
+	databases := make(map[string]bool)
+	for _, db := range d.Databases {
+		databases[db] = true
+	}
+	tables := make(map[string]bool)
+	for _, table := range d.Tables {
+		tables[table] = true
+	}
+
+	sizes := make(map[string]uint64)
+	for rows.Next() {
+		var schema, table string
+		var size uint64
+		if err := rows.Scan(&schema, &table, &size); err != nil {
+			return nil, errors.Trace(err)
+		}
+		name := schema + "." + table
+
+		if len(databases) > 0 && !databases[schema] {
+			continue
+		}
+		if len(tables) > 0 && !tables[name] && !tables[table] {
+			continue
+		}
+		if !match(name) {
+			continue
+		}
+		sizes[name] = size
+	}
+	return sizes, errors.Trace(rows.Err())
+}
+
+// start scanning the output directory, sending progress to events.
+func (p *progressTracker) start(events *eventDispatcher) {
+	p.events = events
+	p.stop = make(chan struct{})
+	p.stopped = make(chan struct{})
+	p.sized = make(chan struct{})
+
+	var ctx context.Context
+	ctx, p.cancelSizes = context.WithCancel(p.ctx)
+	go p.loadSizes(ctx)
+
+	go func() {
+		defer close(p.stopped)
+
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.scan()
+				p.report()
+			}
+		}
+	}()
+}
+
+// stop scanning and send the final progress.
+func (p *progressTracker) finish(success bool) {
+	close(p.stop)
+	<-p.stopped
+	p.cancelSizes()
+	<-p.sized
+
+	p.scan()
+	p.mu.Lock()
+	if success {
+		p.done = true
+		for _, t := range p.tables {
+			t.finished = true
+		}
+	}
+	p.mu.Unlock()
+	p.report()
+}
+
+// update the written bytes of every table from its data files.
+func (p *progressTracker) scan() {
+	infos, err := ioutil.ReadDir(p.dir)
+	if err != nil {
+		return
+	}
+
+	written := make(map[string]uint64)
+	for _, info := range infos {
+		if name, ok := dataFileTable(info.Name()); ok {
+			written[name] += uint64(info.Size())
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, size := range written {
+		t, ok := p.tables[name]
+		if !ok {
+			t = new(tableProgress)
+			p.tables[name] = t
+		}
+		t.written = size
+	}
+}
+
+func (p *progressTracker) report() {
+	progress := p.Progress()
+	p.events.send(Event{
+		Kind:     EventProgress,
+		Time:     time.Now(),
+		Level:    LevelInfo,
+		Thread:   -1,
+		Message:  fmt.Sprintf("%.1f%% done, %d/%d tables", progress.Percent, progress.TablesFinished, progress.TablesTotal),
+		Progress: &progress,
+	})
+}
+
+// snapshot of the current progress.
+func (p *progressTracker) Progress() Progress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	progress := Progress{Started: p.started, TablesTotal: len(p.tables), Done: p.done}
+
+	var done uint64
+	for _, t := range p.tables {
+		progress.BytesExpected += t.expected
+		progress.BytesWritten += t.written
+		if t.finished {
+			progress.TablesFinished++
+			done += t.expected
+		} else if t.written < t.expected {
+			done += t.written
+		} else {
+			done += t.expected
+		}
+	}
+
+	switch {
+	case p.done:
+		progress.Percent = 100
+	case progress.BytesExpected > 0:
+		progress.Percent = float64(done) * 100 / float64(progress.BytesExpected)
+	case progress.TablesTotal > 0:
+		progress.Percent = float64(progress.TablesFinished) * 100 / float64(progress.TablesTotal)
+	}
+	// never claim completion before mydumper exits.
+	if !p.done && progress.Percent > 99.9 {
+		progress.Percent = 99.9
+	}
+
+	if !p.done && progress.Percent > 0 {
+		elapsed := time.Since(p.started)
+		progress.ETA = time.Duration(float64(elapsed) * (100 - progress.Percent) / progress.Percent)
+	}
+	return progress
+}
+
+// follow which table each thread dumps. when a thread moves on or shuts
+// down, its previous table is finished.
+func (p *progressTracker) HandleEvent(e Event) {
+	if e.Kind == EventLog && e.Thread >= 0 {
+		p.mu.Lock()
+		if prev, ok := p.threads[e.Thread]; ok && prev != e.Database+"."+e.Table {
+			if t, ok := p.tables[prev]; ok {
+				t.finished = true
+			}
+			delete(p.threads, e.Thread)
+		}
+		if len(e.Table) > 0 && strings.Contains(e.Message, "dumping data") {
+			p.threads[e.Thread] = e.Database + "." + e.Table
+		}
+		p.mu.Unlock()
+	}
+
+	if p.next != nil {
+		p.next.HandleEvent(e)
+	}
+}
+
+// "db.table" of a mydumper data file such as db.t1.sql, db.t1.00001.sql or
+// db.t1.00001.sql.gz.
+func dataFileTable(name string) (string, bool) {
+	f := parseBackupFile(name)
+	if f.Kind != FileData {
+		return "", false
+	}
+	return f.Database + "." + f.Table, true
+}
+
+func isDigits(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
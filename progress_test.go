@@ -0,0 +1,164 @@
+package mydumper
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+)
+
+func TestCompileRegex(t *testing.T) {
+
+	cases := []struct {
+		regex string
+		name  string
+		match bool
+	}{
+		{"^(?!(sys))", "dev.t1", true},
+		{"^(?!(sys))", "sys.t1", false},
+		{"^(?!(mysql|test))", "test.t1", false},
+		{"^(?!(mysql|test))", "dev.t1", true},
+		{"^(?!(mysql\\.))dev", "dev.t1", true},
+		{"^(?!(mysql\\.))dev", "prod.t1", false},
+		{"^dev\\.t[0-9]$", "dev.t1", true},
+	}
+
+	for _, c := range cases {
+		match, err := compileRegex(c.regex)
+		if err != nil {
+			t.Errorf("%q: %s", c.regex, err)
+			continue
+		}
+		if match(c.name) != c.match {
+			t.Errorf("%q on %q: expected %v", c.regex, c.name, c.match)
+		}
+	}
+
+	for _, regex := range []string{"^(?!(sys)", "^dev(?=\\.t1)", "^(dev"} {
+		if _, err := compileRegex(regex); err == nil {
+			t.Errorf("%q: expected error", regex)
+		}
+	}
+}
+
+func TestCheckRegex(t *testing.T) {
+
+	// valid PCRE that compileRegex cannot emulate.
+	for _, regex := range []string{"^db\\.(?!tmp_)", "\\d++", "^(?<=a)b", "[)(]x", "[]a]", "\\("} {
+		if err := checkRegex(regex); err != nil {
+			t.Errorf("%q: %s", regex, err)
+		}
+	}
+	for _, regex := range []string{"^(?!(sys)", "^(dev", "dev)", "[abc", "(a[)]"} {
+		if err := checkRegex(regex); err == nil {
+			t.Errorf("%q: expected error", regex)
+		}
+	}
+}
+
+func TestDataFileTable(t *testing.T) {
+
+	cases := map[string]string{
+		"dev.t1.sql":             "dev.t1",
+		"dev.t1.00001.sql":       "dev.t1",
+		"dev.t1.00001.sql.gz":    "dev.t1",
+		"dev.t1-schema.sql":      "",
+		"dev-schema-create.sql":  "",
+		"dev.t1-schema-view.sql": "",
+		"metadata":               "",
+	}
+
+	for file, expected := range cases {
+		name, ok := dataFileTable(file)
+		if name != expected || ok != (len(expected) > 0) {
+			t.Errorf("%s: got %q", file, name)
+		}
+	}
+}
+
+func TestDumpProgress(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	bin := fakeBinary(t, dir, "mydumper",
+		"echo '** Message: Thread 1 dumping data for `dev`.`t1`' >&2; echo data > "+dir+"/dev.t1.sql; "+
+			"echo '** Message: Thread 1 dumping data for `dev`.`t2`' >&2; echo data > "+dir+"/dev.t2.00001.sql; "+
+			"echo '** Message: Thread 1 shutting down' >&2")
+
+	// nothing listens on port 1, so only written bytes are tracked.
+	dumper, err := NewDumper(bin, "127.0.0.1", 1, "root", "111111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dumper.SetOutPutDir(dir)
+	dumper.SetTrackProgress(true)
+
+	var last *Progress
+	dumper.SetEventHandler(EventHandlerFunc(func(e Event) {
+		if e.Kind == EventProgress {
+			last = e.Progress
+		}
+	}))
+
+	if err := dumper.Dump(); err != nil {
+		t.Fatal(err)
+	}
+
+	progress, err := dumper.Progress()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !progress.Done || progress.Percent != 100 || progress.TablesTotal != 2 || progress.TablesFinished != 2 || progress.BytesWritten != 10 {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+	if last == nil || !last.Done {
+		t.Errorf("final progress event not sent: %+v", last)
+	}
+}
+
+func TestDumpProgressDB(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	// information_schema.TABLES of the dumped server, in SQLite.
+	db, err := sql.Open(CatalogDriver, ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	for _, stmt := range []string{
+		`ATTACH DATABASE ':memory:' AS information_schema`,
+		`CREATE TABLE information_schema.TABLES (TABLE_SCHEMA text, TABLE_NAME text, DATA_LENGTH integer, TABLE_TYPE text)`,
+		`INSERT INTO information_schema.TABLES VALUES ('dev','t1',100,'BASE TABLE'), ('dev','v1',NULL,'VIEW'), ('prod','t1',50,'BASE TABLE')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bin := fakeBinary(t, dir, "mydumper", "sleep 2; echo data > "+dir+"/dev.t1.sql")
+	dumper, err := NewDumper(bin, "127.0.0.1", 1, "root", "111111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dumper.SetOutPutDir(dir)
+	dumper.AddDatabase("dev")
+	dumper.SetTrackProgress(true)
+	dumper.SetProgressDB(db)
+
+	var running *Progress
+	dumper.SetEventHandler(EventHandlerFunc(func(e Event) {
+		if e.Kind == EventProgress && !e.Progress.Done && running == nil {
+			running = e.Progress
+		}
+	}))
+	if err := dumper.Dump(); err != nil {
+		t.Fatal(err)
+	}
+
+	if running == nil || running.BytesExpected != 100 || running.TablesTotal != 1 {
+		t.Errorf("expected sizes while running, got %+v", running)
+	}
+}
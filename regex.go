@@ -0,0 +1,112 @@
+package mydumper
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// compile a mydumper --regex into a matcher for "db.table" names.
+// mydumper uses PCRE while Go's regexp has no lookarounds, so the common
+// "^(?!(a|b))rest" form is split into a negated and a positive expression.
+// other lookarounds are rejected.
+func compileRegex(pattern string) (func(name string) bool, error) {
+	if !strings.HasPrefix(pattern, "^(?!") {
+		if strings.Contains(pattern, "(?=") || strings.Contains(pattern, "(?!") || strings.Contains(pattern, "(?<") {
+			return nil, errors.NotSupportedf("lookaround in regex %q", pattern)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Annotatef(err, "regex %q", pattern)
+		}
+		return re.MatchString, nil
+	}
+
+	end := closingParen(pattern, len("^"))
+	if end < 0 {
+		return nil, errors.NotValidf("unbalanced parentheses in regex %q", pattern)
+	}
+
+	negated, err := regexp.Compile("^(?:" + pattern[len("^(?!"):end] + ")")
+	if err != nil {
+		return nil, errors.Annotatef(err, "regex %q", pattern)
+	}
+	rest, err := compileRegex("^" + pattern[end+1:])
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	return func(name string) bool {
+		return !negated.MatchString(name) && rest(name)
+	}, nil
+}
+
+// check the syntax mydumper's PCRE would certainly reject: unbalanced
+// parentheses and unterminated character classes. anything else is left to
+// mydumper, compileRegex does not support all of PCRE.
+func checkRegex(pattern string) error {
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '[':
+			end := closingBracket(pattern, i)
+			if end < 0 {
+				return errors.NotValidf("unterminated character class in regex %q", pattern)
+			}
+			i = end
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth < 0 {
+				return errors.NotValidf("unbalanced parentheses in regex %q", pattern)
+			}
+		}
+	}
+	if depth != 0 {
+		return errors.NotValidf("unbalanced parentheses in regex %q", pattern)
+	}
+	return nil
+}
+
+// index of the bracket closing the character class at open, -1 when
+// unterminated. a ] right after [ or [^ is a literal.
+func closingBracket(s string, open int) int {
+	i := open + 1
+	if i < len(s) && s[i] == '^' {
+		i++
+	}
+	if i < len(s) && s[i] == ']' {
+		i++
+	}
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ']':
+			return i
+		}
+	}
+	return -1
+}
+
+// index of the parenthesis closing the one at open, -1 when unbalanced.
+func closingParen(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,315 @@
+package mydumper
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+type (
+	// retention policy for the runs of a LayoutPerRun base directory. a run is
+	// kept when any rule keeps it. the newest good backup of every server is
+	// never deleted.
+	Retention struct {
+		// OutPutDir of the dumps, holding one <host>_<port> directory per server.
+		BaseDir string `json:"base_dir" db:"base_dir"`
+		// keep the newest good backups. 0 disables.
+		KeepLast int `json:"keep_last" db:"keep_last"`
+		// keep good backups younger than this. 0 disables.
+		MaxAge time.Duration `json:"max_age" db:"max_age"`
+		// keep the newest good backup of this many days, ISO weeks and months. 0 disables.
+		KeepDaily   int `json:"keep_daily" db:"keep_daily"`
+		KeepWeekly  int `json:"keep_weekly" db:"keep_weekly"`
+		KeepMonthly int `json:"keep_monthly" db:"keep_monthly"`
+		// only report what would be deleted.
+		DryRun bool `json:"dry_run" db:"dry_run"`
+		// mark the records of deleted runs expired. its records also decide
+		// which runs are good, nil decides from the metadata files.
+		Catalog *Catalog `json:"-" db:"-"`
+	}
+
+	// one run and the decision of the policy.
+	RetentionItem struct {
+		Dir     string    `json:"dir"`
+		Server  string    `json:"server"`
+		Started time.Time `json:"started"`
+		// a completed full backup.
+		Good   bool   `json:"good"`
+		Delete bool   `json:"delete"`
+		Reason string `json:"reason"`
+		// catalog records of the run.
+		Records []uint64 `json:"records,omitempty"`
+	}
+)
+
+// new retention policy for the runs under base.
+func NewRetention(base string) (*Retention, error) {
+	if len(base) == 0 {
+		return nil, errors.NotValidf("empty base directory")
+	}
+
+	r := new(Retention)
+	r.BaseDir = base
+	return r, nil
+}
+
+// set number of newest good backups to keep
+func (r *Retention) SetKeepLast(n int) {
+	r.KeepLast = n
+}
+
+// set age of good backups to keep
+func (r *Retention) SetMaxAge(age time.Duration) {
+	r.MaxAge = age
+}
+
+// set number of daily, weekly and monthly backups to keep
+func (r *Retention) SetGFS(daily int, weekly int, monthly int) {
+	r.KeepDaily = daily
+	r.KeepWeekly = weekly
+	r.KeepMonthly = monthly
+}
+
+// enable/disable dry run
+func (r *Retention) SetDryRun(enable bool) {
+	r.DryRun = enable
+}
+
+// set catalog of the backups
+func (r *Retention) SetCatalog(catalog *Catalog) {
+	r.Catalog = catalog
+}
+
+// apply the policy. returns every run found with its decision, deleted runs
+// are removed unless DryRun is set. fails with ErrDirectoryLocked while a
+// server is being dumped, a run being restored is kept and reported in use.
+func (r *Retention) Apply() ([]RetentionItem, error) {
+	return r.apply(time.Now())
+}
+
+func (r *Retention) apply(now time.Time) ([]RetentionItem, error) {
+	if r.KeepLast <= 0 && r.MaxAge <= 0 && r.KeepDaily <= 0 && r.KeepWeekly <= 0 && r.KeepMonthly <= 0 {
+		return nil, errors.NotValidf("retention without rules")
+	}
+
+	servers, err := ioutil.ReadDir(r.BaseDir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	items := make([]RetentionItem, 0)
+	for _, server := range servers {
+		if !server.IsDir() || strings.HasPrefix(server.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(r.BaseDir, server.Name())
+
+		var lock *dirLock
+		if !r.DryRun {
+			if lock, err = lockDir(context.Background(), dir, 0); err != nil {
+				return items, errors.Trace(err)
+			}
+		}
+		runs, err := r.applyServer(dir, now)
+		lock.unlock()
+
+		items = append(items, runs...)
+		if err != nil {
+			return items, errors.Trace(err)
+		}
+	}
+	return items, nil
+}
+
+// decide, and unless DryRun delete, the runs of one server directory.
+func (r *Retention) applyServer(dir string, now time.Time) ([]RetentionItem, error) {
+	items, err := r.scanRuns(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	r.decide(items, now)
+
+	if r.DryRun {
+		return items, nil
+	}
+	for i := range items {
+		item := &items[i]
+		if !item.Delete {
+			continue
+		}
+
+		// a Loader restoring the run holds its lock.
+		lock, err := lockDir(context.Background(), item.Dir, 0)
+		if IsDirectoryLocked(err) {
+			item.Delete = false
+			item.Reason = "in use: " + item.Reason
+			continue
+		}
+		if err != nil {
+			return items, errors.Annotatef(err, "lock %s", item.Dir)
+		}
+		if err := lock.remove(item.Dir); err != nil {
+			return items, errors.Annotatef(err, "delete %s", item.Dir)
+		}
+		if err := r.expire(*item); err != nil {
+			return items, errors.Trace(err)
+		}
+	}
+	return items, nil
+}
+
+// runs of a server directory, newest first. names that are not run ids are
+// not ours and never returned.
+func (r *Retention) scanRuns(dir string) ([]RetentionItem, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	items := make([]RetentionItem, 0, len(infos))
+	for _, info := range infos {
+		if !info.IsDir() {
+			continue
+		}
+		failed := strings.HasSuffix(info.Name(), FailedRunSuffix)
+		id := strings.TrimSuffix(info.Name(), FailedRunSuffix)
+		if i := strings.LastIndex(id, "-"); i > 0 && isDigits(id[i+1:]) {
+			id = id[:i]
+		}
+		started, err := time.Parse("20060102T150405Z", id)
+		if err != nil {
+			continue
+		}
+
+		item := RetentionItem{
+			Dir:     filepath.Join(dir, info.Name()),
+			Server:  filepath.Base(dir),
+			Started: started,
+		}
+		if err := r.classify(&item, failed); err != nil {
+			return nil, errors.Trace(err)
+		}
+		items = append(items, item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Started.Equal(items[j].Started) {
+			return items[i].Dir > items[j].Dir
+		}
+		return items[i].Started.After(items[j].Started)
+	})
+	return items, nil
+}
+
+// decide whether the run is a good backup, from the catalog when it has
+// backup records of the run, else from its metadata file. restore records
+// of the run say nothing about the dump and are ignored.
+func (r *Retention) classify(item *RetentionItem, failed bool) error {
+	if r.Catalog != nil {
+		records, err := r.Catalog.List(RecordFilter{BackupDir: item.Dir, Operations: []Operation{OperationBackup}})
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, record := range records {
+			item.Records = append(item.Records, record.Id)
+			if record.Type == TypeFull && record.State == StateSucceeded {
+				item.Good = true
+			}
+		}
+		if len(records) > 0 {
+			return nil
+		}
+	}
+	if failed {
+		return nil
+	}
+
+	meta, err := NewMeta(item.Dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	item.Good = meta.ReadMetadata() == nil && meta.Completed
+	return nil
+}
+
+// set Delete and Reason of items, sorted newest first.
+func (r *Retention) decide(items []RetentionItem, now time.Time) {
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	months := make(map[string]bool)
+	good := 0
+
+	for i := range items {
+		item := &items[i]
+		if !item.Good {
+			if good == 0 {
+				item.Reason = "newer than the newest good backup"
+			} else {
+				item.Delete = true
+				item.Reason = "not a good backup"
+			}
+			continue
+		}
+		good++
+
+		local := item.Started.Local()
+		day := local.Format("2006-01-02")
+		year, week := local.ISOWeek()
+		isoWeek := fmt.Sprintf("%d-%02d", year, week)
+		month := local.Format("2006-01")
+
+		reasons := make([]string, 0, 4)
+		if good == 1 {
+			reasons = append(reasons, "newest good backup")
+		}
+		if good <= r.KeepLast {
+			reasons = append(reasons, fmt.Sprintf("one of the last %d", r.KeepLast))
+		}
+		if r.MaxAge > 0 && now.Sub(item.Started) < r.MaxAge {
+			reasons = append(reasons, fmt.Sprintf("younger than %s", r.MaxAge))
+		}
+		if !days[day] && len(days) < r.KeepDaily {
+			days[day] = true
+			reasons = append(reasons, "daily "+day)
+		}
+		if !weeks[isoWeek] && len(weeks) < r.KeepWeekly {
+			weeks[isoWeek] = true
+			reasons = append(reasons, "weekly "+isoWeek)
+		}
+		if !months[month] && len(months) < r.KeepMonthly {
+			months[month] = true
+			reasons = append(reasons, "monthly "+month)
+		}
+
+		if len(reasons) == 0 {
+			item.Delete = true
+			item.Reason = "expired"
+			continue
+		}
+		item.Reason = strings.Join(reasons, ", ")
+	}
+}
+
+// mark the catalog records of a deleted run expired.
+func (r *Retention) expire(item RetentionItem) error {
+	for _, id := range item.Records {
+		record, err := r.Catalog.Get(id)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if !record.State.CanTransition(StateExpired) {
+			continue
+		}
+		record.State = StateExpired
+		if err := r.Catalog.Update(record); err != nil {
+			return errors.Annotatef(err, "expire record %d", id)
+		}
+	}
+	return nil
+}
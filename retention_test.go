@@ -0,0 +1,266 @@
+package mydumper
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// create a run started at t in the server directory, completed unless failed.
+func makeRun(t *testing.T, server string, started time.Time, failed bool) string {
+	dir := filepath.Join(server, runID(started))
+	if failed {
+		dir += FailedRunSuffix
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	meta := "Started dump at: " + started.Format("2006-01-02 15:04:05") + "\n"
+	if !failed {
+		meta += "Finished dump at: " + started.Add(time.Minute).Format("2006-01-02 15:04:05") + "\n"
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "metadata"), []byte(meta), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func retentionDecisions(items []RetentionItem) map[string]bool {
+	deleted := make(map[string]bool)
+	for _, item := range items {
+		deleted[filepath.Base(item.Dir)] = item.Delete
+	}
+	return deleted
+}
+
+func TestRetention(t *testing.T) {
+
+	base, err := ioutil.TempDir("", "retention")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+	server := filepath.Join(base, "127.0.0.1_3306")
+
+	now := time.Date(2019, 3, 20, 12, 0, 0, 0, time.Local)
+	day := 24 * time.Hour
+	runs := map[string]time.Time{
+		"today":       now.Add(-time.Hour),
+		"today-early": now.Add(-3 * time.Hour),
+		"yesterday":   now.Add(-day),
+		"last-week":   now.Add(-7 * day),
+		"last-month":  now.Add(-30 * day),
+		"old":         now.Add(-90 * day),
+	}
+	names := make(map[string]string)
+	for name, started := range runs {
+		names[name] = filepath.Base(makeRun(t, server, started, false))
+	}
+	names["failed-old"] = filepath.Base(makeRun(t, server, now.Add(-2*day), true))
+	names["failed-new"] = filepath.Base(makeRun(t, server, now.Add(-time.Minute), true))
+	if err := ioutil.WriteFile(filepath.Join(server, "notes"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRetention(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.apply(now); err == nil {
+		t.Error("expected error without rules")
+	}
+
+	r.SetGFS(2, 2, 2)
+	r.SetDryRun(true)
+	items, err := r.apply(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]bool{
+		"today":       false, // newest, daily, weekly, monthly
+		"today-early": true,
+		"yesterday":   false, // daily
+		"last-week":   false, // weekly
+		"last-month":  false, // monthly
+		"old":         true,
+		"failed-old":  true,
+		"failed-new":  false,
+	}
+	decisions := retentionDecisions(items)
+	for name, del := range expected {
+		if decisions[names[name]] != del {
+			t.Errorf("%s: expected delete %v, got %+v", name, del, items)
+		}
+	}
+	if len(items) != len(expected) {
+		t.Errorf("expected %d runs, got %d", len(expected), len(items))
+	}
+	for name := range expected {
+		if _, err := os.Stat(filepath.Join(server, names[name])); err != nil {
+			t.Errorf("dry run deleted %s", name)
+		}
+	}
+
+	// keep-last and max-age only, applied.
+	r.SetGFS(0, 0, 0)
+	r.SetKeepLast(2)
+	r.SetMaxAge(10 * day)
+	r.SetDryRun(false)
+	if _, err := r.apply(now); err != nil {
+		t.Fatal(err)
+	}
+	for name, keep := range map[string]bool{"today": true, "today-early": true, "yesterday": true, "last-week": true, "last-month": false, "old": false, "failed-old": false, "failed-new": true} {
+		_, err := os.Stat(filepath.Join(server, names[name]))
+		if keep != (err == nil) {
+			t.Errorf("%s: expected kept %v, got %v", name, keep, err)
+		}
+	}
+}
+
+func TestRetentionKeepsNewestGood(t *testing.T) {
+
+	base, err := ioutil.TempDir("", "retention")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+	server := filepath.Join(base, "db1_3306")
+
+	now := time.Now()
+	only := makeRun(t, server, now.Add(-400*24*time.Hour), false)
+	makeRun(t, server, now.Add(-time.Hour), true)
+
+	c, cleanup := newTestCatalog(t)
+	defer cleanup()
+	failed := &Recorder{State: StateFailed, BackupDir: only + FailedRunSuffix}
+	good := &Recorder{State: StateSucceeded, BackupDir: only, StartTimestamp: now, EndTimestamp: now}
+	for _, record := range []*Recorder{failed, good} {
+		if err := c.Insert(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewRetention(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetMaxAge(time.Hour)
+	r.SetCatalog(c)
+	items, err := r.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(only); err != nil {
+		t.Errorf("the only good backup was deleted: %+v", items)
+	}
+	if record, _ := c.Get(good.Id); record.State != StateSucceeded {
+		t.Errorf("kept run marked %s", record.State)
+	}
+
+	// a newer good backup lets the old one expire.
+	newer := makeRun(t, server, now.Add(-time.Minute), false)
+	if _, err := r.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(only); !os.IsNotExist(err) {
+		t.Errorf("expired run was kept")
+	}
+	if _, err := os.Stat(newer); err != nil {
+		t.Errorf("newest run was deleted")
+	}
+	if record, _ := c.Get(good.Id); record.State != StateExpired {
+		t.Errorf("deleted run marked %s", record.State)
+	}
+}
+
+func TestRetentionIgnoresRestoreRecords(t *testing.T) {
+
+	base, err := ioutil.TempDir("", "retention")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+	server := filepath.Join(base, "db1_3306")
+
+	now := time.Now()
+	restored := makeRun(t, server, now.Add(-2*time.Hour), false)
+	makeRun(t, server, now.Add(-time.Hour), false)
+
+	c, cleanup := newTestCatalog(t)
+	defer cleanup()
+	restore := &Recorder{Operation: OperationRestore, State: StateSucceeded, BackupDir: restored, StartTimestamp: now, EndTimestamp: now}
+	if err := c.Insert(restore); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRetention(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetMaxAge(24 * time.Hour)
+	r.SetCatalog(c)
+	items, err := r.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if !item.Good || item.Delete || len(item.Records) > 0 {
+			t.Errorf("unexpected decision %+v", item)
+		}
+	}
+	if _, err := os.Stat(restored); err != nil {
+		t.Errorf("restored run was deleted: %+v", items)
+	}
+	if record, _ := c.Get(restore.Id); record.State != StateSucceeded {
+		t.Errorf("restore record marked %s", record.State)
+	}
+}
+
+func TestRetentionKeepsLockedRun(t *testing.T) {
+
+	base, err := ioutil.TempDir("", "retention")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(base)
+	server := filepath.Join(base, "db1_3306")
+
+	now := time.Now()
+	restoring := makeRun(t, server, now.Add(-48*time.Hour), false)
+	makeRun(t, server, now.Add(-time.Hour), false)
+
+	lock, err := lockDir(context.Background(), restoring, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewRetention(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetKeepLast(1)
+	items, err := r.apply(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(restoring); err != nil {
+		t.Fatalf("locked run was deleted: %+v", items)
+	}
+	for _, item := range items {
+		if item.Dir == restoring && (item.Delete || !strings.HasPrefix(item.Reason, "in use")) {
+			t.Errorf("unexpected decision %+v", item)
+		}
+	}
+
+	lock.unlock()
+	if _, err := r.apply(now); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(restoring); !os.IsNotExist(err) {
+		t.Errorf("unlocked run was kept")
+	}
+}
@@ -0,0 +1,328 @@
+package mydumper
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+type (
+	// daily period in which a job does not start, such as 22:00-06:00.
+	BlackoutWindow struct {
+		// offsets from midnight, End before Start wraps past midnight.
+		Start time.Duration `json:"start"`
+		End   time.Duration `json:"end"`
+	}
+
+	// a Dumper run on a cron schedule, see Scheduler.
+	Job struct {
+		Name     string        `json:"name"`
+		Schedule *CronSchedule `json:"-"`
+		Dumper   *Dumper       `json:"-"`
+		// random delay added to every run, spreads jobs sharing a schedule.
+		Jitter time.Duration `json:"jitter"`
+		// runs falling in one of the windows move to the next scheduled time.
+		Blackouts []BlackoutWindow `json:"blackouts"`
+	}
+
+	// state of a scheduled job.
+	JobStatus struct {
+		Name string `json:"name"`
+		// planned start of the next run, jitter included. zero when none.
+		NextRun time.Time `json:"next_run"`
+		// start of the last run, zero when it did not run yet.
+		LastRun time.Time `json:"last_run"`
+		// error of the last finished run.
+		LastError error `json:"-"`
+		Running   bool  `json:"running"`
+		// runs skipped because the previous one was still running.
+		Overlaps uint64 `json:"overlaps"`
+	}
+
+	// runs Dumper jobs on cron schedules. a job never overlaps itself, a run
+	// due while the previous one is still running is skipped.
+	Scheduler struct {
+		mu   sync.Mutex
+		jobs map[string]*scheduledJob
+		wg   sync.WaitGroup
+		rand *rand.Rand
+		now  func() time.Time
+		// wakes Run when jobs change.
+		changed chan struct{}
+	}
+
+	scheduledJob struct {
+		job    *Job
+		status JobStatus
+	}
+)
+
+// parse a daily window such as "22:00-06:00".
+func ParseBlackoutWindow(window string) (BlackoutWindow, error) {
+	var sh, sm, eh, em int
+	if _, err := fmt.Sscanf(window, "%d:%d-%d:%d", &sh, &sm, &eh, &em); err != nil {
+		return BlackoutWindow{}, errors.NotValidf("blackout window %q", window)
+	}
+	if sh > 23 || eh > 24 || sm > 59 || em > 59 || sh < 0 || eh < 0 || sm < 0 || em < 0 {
+		return BlackoutWindow{}, errors.NotValidf("blackout window %q", window)
+	}
+
+	w := BlackoutWindow{
+		Start: time.Duration(sh)*time.Hour + time.Duration(sm)*time.Minute,
+		End:   time.Duration(eh)*time.Hour + time.Duration(em)*time.Minute,
+	}
+	return w, nil
+}
+
+// t is inside the window, in t's location.
+func (w BlackoutWindow) Contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// new job running d on the cron expression expr, see ParseCron.
+func NewJob(name string, expr string, d *Dumper) (*Job, error) {
+	if len(name) == 0 {
+		return nil, errors.NotValidf("empty job name")
+	}
+	if d == nil {
+		return nil, errors.NotValidf("job %s without dumper", name)
+	}
+	// a daemon never returns, the scheduler replaces it.
+	if d.Daemon {
+		return nil, errors.NotValidf("job %s: dumper in daemon mode", name)
+	}
+	schedule, err := ParseCron(expr)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	j := new(Job)
+	j.Name = name
+	j.Schedule = schedule
+	j.Dumper = d
+	j.Blackouts = make([]BlackoutWindow, 0)
+	return j, nil
+}
+
+// set jitter
+func (j *Job) SetJitter(jitter time.Duration) {
+	j.Jitter = jitter
+}
+
+// add blackout window such as "22:00-06:00"
+func (j *Job) AddBlackout(window string) error {
+	w, err := ParseBlackoutWindow(window)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	j.Blackouts = append(j.Blackouts, w)
+	return nil
+}
+
+func (j *Job) blackedOut(t time.Time) bool {
+	for _, w := range j.Blackouts {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// new scheduler without jobs.
+func NewScheduler() (*Scheduler, error) {
+	s := new(Scheduler)
+	s.jobs = make(map[string]*scheduledJob)
+	s.rand = rand.New(rand.NewSource(time.Now().UnixNano()))
+	s.now = time.Now
+	s.changed = make(chan struct{}, 1)
+	return s, nil
+}
+
+// add job, replacing the schedule of a job with the same name.
+func (s *Scheduler) AddJob(job *Job) error {
+	if job == nil || job.Schedule == nil || job.Dumper == nil {
+		return errors.NotValidf("job")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sj, ok := s.jobs[job.Name]
+	if !ok {
+		sj = &scheduledJob{status: JobStatus{Name: job.Name}}
+		s.jobs[job.Name] = sj
+	}
+	sj.job = job
+	sj.status.NextRun = s.plan(job, s.now())
+	s.notify()
+	return nil
+}
+
+// remove job. a running dump of it is not interrupted.
+func (s *Scheduler) RemoveJob(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[name]; !ok {
+		return errors.NotFoundf("job %s", name)
+	}
+	delete(s.jobs, name)
+	s.notify()
+	return nil
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// status of job name.
+func (s *Scheduler) Status(name string) (JobStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sj, ok := s.jobs[name]
+	if !ok {
+		return JobStatus{}, errors.NotFoundf("job %s", name)
+	}
+	return sj.status, nil
+}
+
+// status of every job, sorted by next run.
+func (s *Scheduler) Jobs() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.jobs))
+	for _, sj := range s.jobs {
+		statuses = append(statuses, sj.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].NextRun.Before(statuses[j].NextRun)
+	})
+	return statuses
+}
+
+// planned start of the next run of job name.
+func (s *Scheduler) NextRun(name string) (time.Time, error) {
+	status, err := s.Status(name)
+	return status.NextRun, errors.Trace(err)
+}
+
+// start of the last run of job name.
+func (s *Scheduler) LastRun(name string) (time.Time, error) {
+	status, err := s.Status(name)
+	return status.LastRun, errors.Trace(err)
+}
+
+// next start of job after t: the next scheduled time outside the blackout
+// windows plus jitter, which is cut short before a window. zero when the
+// schedule has no such time.
+func (s *Scheduler) plan(job *Job, t time.Time) time.Time {
+	next := job.Schedule.Next(t)
+	// a window covering every scheduled time would never end.
+	for i := 0; i < 10000 && !next.IsZero() && job.blackedOut(next); i++ {
+		next = job.Schedule.Next(next)
+	}
+	if next.IsZero() || job.blackedOut(next) {
+		return time.Time{}
+	}
+	if job.Jitter > 0 {
+		// the jitter must not push the start into a window. windows start on
+		// a minute, as the scheduled times do.
+		limit := job.Jitter
+		for offset := time.Minute; offset < job.Jitter; offset += time.Minute {
+			if job.blackedOut(next.Add(offset)) {
+				limit = offset
+				break
+			}
+		}
+		next = next.Add(time.Duration(s.rand.Int63n(int64(limit))))
+	}
+	return next
+}
+
+// run the jobs until ctx is done, then wait for the running dumps, which are
+// cancelled through ctx.
+func (s *Scheduler) Run(ctx context.Context) error {
+	defer s.wg.Wait()
+
+	for {
+		wait := time.Minute
+		if next := s.earliest(); !next.IsZero() {
+			wait = next.Sub(s.now())
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Trace(ErrCancelled)
+		case <-s.changed:
+			timer.Stop()
+		case <-timer.C:
+			s.runDue(ctx, s.now())
+		}
+	}
+}
+
+// earliest planned run, zero without jobs.
+func (s *Scheduler) earliest() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var earliest time.Time
+	for _, sj := range s.jobs {
+		next := sj.status.NextRun
+		if !next.IsZero() && (earliest.IsZero() || next.Before(earliest)) {
+			earliest = next
+		}
+	}
+	return earliest
+}
+
+// start the jobs due at now and plan their next runs.
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sj := range s.jobs {
+		if sj.status.NextRun.IsZero() || sj.status.NextRun.After(now) {
+			continue
+		}
+		sj.status.NextRun = s.plan(sj.job, now)
+
+		if sj.status.Running {
+			sj.status.Overlaps++
+			continue
+		}
+		sj.status.Running = true
+		sj.status.LastRun = now
+
+		s.wg.Add(1)
+		go s.runJob(ctx, sj, sj.job)
+	}
+}
+
+func (s *Scheduler) runJob(ctx context.Context, sj *scheduledJob, job *Job) {
+	defer s.wg.Done()
+
+	err := job.Dumper.DumpContext(ctx)
+
+	s.mu.Lock()
+	sj.status.Running = false
+	sj.status.LastError = err
+	s.mu.Unlock()
+}
@@ -0,0 +1,169 @@
+package mydumper
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBlackoutWindow(t *testing.T) {
+
+	night, err := ParseBlackoutWindow("22:00-06:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lunch, err := ParseBlackoutWindow("12:00-13:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(h, m int) time.Time {
+		return time.Date(2019, 1, 16, h, m, 0, 0, time.UTC)
+	}
+	cases := []struct {
+		w        BlackoutWindow
+		t        time.Time
+		expected bool
+	}{
+		{night, at(23, 0), true},
+		{night, at(3, 0), true},
+		{night, at(6, 0), false},
+		{night, at(12, 0), false},
+		{lunch, at(12, 0), true},
+		{lunch, at(13, 29), true},
+		{lunch, at(13, 30), false},
+	}
+	for _, tc := range cases {
+		if tc.w.Contains(tc.t) != tc.expected {
+			t.Errorf("%+v %s: expected %v", tc.w, tc.t, tc.expected)
+		}
+	}
+
+	for _, window := range []string{"", "25:00-01:00", "10:00", "10:60-11:00"} {
+		if _, err := ParseBlackoutWindow(window); err == nil {
+			t.Errorf("%q: expected error", window)
+		}
+	}
+}
+
+func TestSchedulerPlan(t *testing.T) {
+
+	s, err := NewScheduler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := NewJob("hourly", "0 * * * *", new(Dumper))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := job.AddBlackout("08:00-18:00"); err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Date(2019, 1, 16, 7, 30, 0, 0, time.UTC)
+	if next := s.plan(job, from); !next.Equal(time.Date(2019, 1, 16, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected next run %s", next)
+	}
+
+	job.SetJitter(10 * time.Minute)
+	for i := 0; i < 20; i++ {
+		next := s.plan(job, from)
+		base := time.Date(2019, 1, 16, 18, 0, 0, 0, time.UTC)
+		if next.Before(base) || !next.Before(base.Add(10*time.Minute)) {
+			t.Fatalf("jitter out of range: %s", next)
+		}
+	}
+
+	// jitter of a slot just before a window stops at the window.
+	early, err := NewJob("early", "55 7 * * *", new(Dumper))
+	if err != nil {
+		t.Fatal(err)
+	}
+	early.SetJitter(10 * time.Minute)
+	early.AddBlackout("08:00-18:00")
+	slot := time.Date(2019, 1, 16, 7, 55, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		next := s.plan(early, from.Add(-time.Hour))
+		if next.Before(slot) || !next.Before(slot.Add(5*time.Minute)) || early.blackedOut(next) {
+			t.Fatalf("jittered start in blackout: %s", next)
+		}
+	}
+
+	daemon := new(Dumper)
+	daemon.SetDaemon(true)
+	if _, err := NewJob("daemon", "* * * * *", daemon); err == nil {
+		t.Error("expected error for a daemon dumper")
+	}
+
+	always, err := NewJob("never", "0 * * * *", new(Dumper))
+	if err != nil {
+		t.Fatal(err)
+	}
+	always.AddBlackout("00:00-24:00")
+	if next := s.plan(always, from); !next.IsZero() {
+		t.Errorf("expected no run inside a permanent blackout, got %s", next)
+	}
+}
+
+func TestSchedulerNoOverlap(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper := newFakeDumper(t, dir, "sleep 1")
+	dumper.SetOutPutDir(dir + "/backup")
+
+	s, err := NewScheduler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := NewJob("minutely", "* * * * *", dumper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := s.NextRun("minutely")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	s.runDue(ctx, next)
+	s.runDue(ctx, next.Add(time.Minute))
+	s.wg.Wait()
+
+	status, err := s.Status("minutely")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Overlaps != 1 || status.Running || status.LastError != nil {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if !status.LastRun.Equal(next) || !status.NextRun.Equal(next.Add(2*time.Minute)) {
+		t.Errorf("unexpected run times %+v", status)
+	}
+
+	if err := s.RemoveJob("minutely"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.LastRun("minutely"); err == nil {
+		t.Error("expected error for removed job")
+	}
+}
+
+func TestSchedulerRunCancel(t *testing.T) {
+
+	s, err := NewScheduler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if err := s.Run(ctx); !IsCancelled(err) {
+		t.Errorf("expected cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,9 @@
+// Package sqlite registers the SQLite driver used by mydumper.NewCatalog.
+// it needs cgo, import it only where the catalog is used:
+//
+//	import _ "github.com/imSQL/go-mydumper/sqlite"
+package sqlite
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
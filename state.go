@@ -0,0 +1,188 @@
+package mydumper
+
+import (
+	"github.com/juju/errors"
+)
+
+type (
+	// kind of backup a Recorder describes.
+	BackupType uint64
+	// tool that made the backup.
+	BackupMethod uint64
+	// lifecycle state of a backup, see CanTransition.
+	BackupState uint64
+	// what the run of a Recorder did.
+	Operation uint64
+)
+
+const (
+	TypeFull BackupType = iota
+	TypeIncremental
+	TypeBinlog
+)
+
+const (
+	MethodMydumper BackupMethod = iota
+	MethodNative
+	MethodOther
+)
+
+const (
+	// a Dumper run making the backup.
+	OperationBackup Operation = iota
+	// a Loader run restoring the backup in BackupDir.
+	OperationRestore
+)
+
+const (
+	StatePending BackupState = iota
+	StateRunning
+	StateSucceeded
+	StateFailed
+	StateCancelled
+	StateExpired
+)
+
+var backupTypeNames = []string{"full", "incremental", "binlog"}
+var backupMethodNames = []string{"mydumper", "native", "other"}
+var backupStateNames = []string{"pending", "running", "succeeded", "failed", "cancelled", "expired"}
+var operationNames = []string{"backup", "restore"}
+
+// legal next states, staying in the same state is always allowed.
+var backupStateTransitions = map[BackupState][]BackupState{
+	StatePending:   {StateRunning, StateFailed, StateCancelled},
+	StateRunning:   {StateSucceeded, StateFailed, StateCancelled},
+	StateSucceeded: {StateExpired},
+	StateFailed:    {StateExpired},
+	StateCancelled: {StateExpired},
+}
+
+func enumString(names []string, v uint64) string {
+	if v < uint64(len(names)) {
+		return names[v]
+	}
+	return "unknown"
+}
+
+func enumParse(names []string, kind string, text []byte) (uint64, error) {
+	for i, name := range names {
+		if name == string(text) {
+			return uint64(i), nil
+		}
+	}
+	return 0, errors.NotValidf("%s %q", kind, text)
+}
+
+func (t BackupType) String() string {
+	return enumString(backupTypeNames, uint64(t))
+}
+
+func (t BackupType) MarshalText() ([]byte, error) {
+	if uint64(t) >= uint64(len(backupTypeNames)) {
+		return nil, errors.NotValidf("backup type %d", uint64(t))
+	}
+	return []byte(t.String()), nil
+}
+
+func (t *BackupType) UnmarshalText(text []byte) error {
+	v, err := enumParse(backupTypeNames, "backup type", text)
+	if err != nil {
+		return err
+	}
+	*t = BackupType(v)
+	return nil
+}
+
+func (m BackupMethod) String() string {
+	return enumString(backupMethodNames, uint64(m))
+}
+
+func (m BackupMethod) MarshalText() ([]byte, error) {
+	if uint64(m) >= uint64(len(backupMethodNames)) {
+		return nil, errors.NotValidf("backup method %d", uint64(m))
+	}
+	return []byte(m.String()), nil
+}
+
+func (m *BackupMethod) UnmarshalText(text []byte) error {
+	v, err := enumParse(backupMethodNames, "backup method", text)
+	if err != nil {
+		return err
+	}
+	*m = BackupMethod(v)
+	return nil
+}
+
+func (o Operation) String() string {
+	return enumString(operationNames, uint64(o))
+}
+
+func (o Operation) MarshalText() ([]byte, error) {
+	if uint64(o) >= uint64(len(operationNames)) {
+		return nil, errors.NotValidf("operation %d", uint64(o))
+	}
+	return []byte(o.String()), nil
+}
+
+func (o *Operation) UnmarshalText(text []byte) error {
+	v, err := enumParse(operationNames, "operation", text)
+	if err != nil {
+		return err
+	}
+	*o = Operation(v)
+	return nil
+}
+
+func (s BackupState) String() string {
+	return enumString(backupStateNames, uint64(s))
+}
+
+func (s BackupState) MarshalText() ([]byte, error) {
+	if uint64(s) >= uint64(len(backupStateNames)) {
+		return nil, errors.NotValidf("backup state %d", uint64(s))
+	}
+	return []byte(s.String()), nil
+}
+
+func (s *BackupState) UnmarshalText(text []byte) error {
+	v, err := enumParse(backupStateNames, "backup state", text)
+	if err != nil {
+		return err
+	}
+	*s = BackupState(v)
+	return nil
+}
+
+// the backup has reached a state it only leaves by expiring.
+func (s BackupState) IsFinal() bool {
+	return s == StateSucceeded || s == StateFailed || s == StateCancelled || s == StateExpired
+}
+
+// s may move to next.
+func (s BackupState) CanTransition(next BackupState) bool {
+	if s == next {
+		return true
+	}
+	for _, allowed := range backupStateTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+func checkTransition(from BackupState, to BackupState) error {
+	if !from.CanTransition(to) {
+		return errors.NewNotValid(nil, "backup state cannot change from "+from.String()+" to "+to.String())
+	}
+	return nil
+}
+
+// move r to state next, refusing illegal transitions.
+func (r *Recorder) SetState(next BackupState) error {
+	if err := checkTransition(r.State, next); err != nil {
+		return err
+	}
+	r.State = next
+	return nil
+}
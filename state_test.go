@@ -0,0 +1,82 @@
+package mydumper
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/juju/errors"
+)
+
+func TestBackupStateTransitions(t *testing.T) {
+
+	legal := [][2]BackupState{
+		{StatePending, StateRunning},
+		{StatePending, StateCancelled},
+		{StateRunning, StateSucceeded},
+		{StateRunning, StateFailed},
+		{StateRunning, StateRunning},
+		{StateSucceeded, StateExpired},
+		{StateFailed, StateExpired},
+	}
+	for _, tr := range legal {
+		if !tr[0].CanTransition(tr[1]) {
+			t.Errorf("%s -> %s: expected legal", tr[0], tr[1])
+		}
+	}
+
+	illegal := [][2]BackupState{
+		{StateSucceeded, StateRunning},
+		{StateFailed, StateSucceeded},
+		{StateExpired, StateSucceeded},
+		{StatePending, StateSucceeded},
+		{StateRunning, StatePending},
+	}
+	for _, tr := range illegal {
+		if tr[0].CanTransition(tr[1]) {
+			t.Errorf("%s -> %s: expected illegal", tr[0], tr[1])
+		}
+	}
+
+	r := &Recorder{State: StateSucceeded}
+	if err := r.SetState(StateRunning); !errors.IsNotValid(err) {
+		t.Errorf("expected not valid, got %v", err)
+	}
+	if r.State != StateSucceeded {
+		t.Errorf("state changed to %s", r.State)
+	}
+}
+
+func TestBackupEnumJSON(t *testing.T) {
+	r := &Recorder{Type: TypeIncremental, Operation: OperationRestore, Method: MethodNative, State: StateCancelled}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields["type"] != "incremental" || fields["operation"] != "restore" || fields["method"] != "native" || fields["state"] != "cancelled" {
+		t.Errorf("unexpected json %s", data)
+	}
+
+	decoded := new(Recorder)
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Type != r.Type || decoded.Operation != r.Operation || decoded.Method != r.Method || decoded.State != r.State {
+		t.Errorf("unexpected record %+v", decoded)
+	}
+
+	if err := json.Unmarshal([]byte(`{"state":"done"}`), decoded); err == nil {
+		t.Error("expected error for unknown state")
+	}
+	if _, err := json.Marshal(&Recorder{State: BackupState(42)}); err == nil {
+		t.Error("expected error for out of range state")
+	}
+	if BackupState(42).String() != "unknown" {
+		t.Errorf("unexpected %s", BackupState(42))
+	}
+}
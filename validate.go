@@ -0,0 +1,145 @@
+package mydumper
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	// a problem with one configuration field.
+	FieldError struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	}
+
+	// every problem found by Validate.
+	// use errors.Cause(err).(*ValidationError) to inspect it.
+	ValidationError struct {
+		Errors []FieldError `json:"errors"`
+	}
+)
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Error())
+	}
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) add(field string, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// nil when no problem was added.
+func (e *ValidationError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// checks shared by Dumper and Loader.
+func validateConnection(v *ValidationError, addr string, port uint64, threads uint64, verbose uint64) {
+	if len(addr) == 0 {
+		v.add("Addr", "must not be empty")
+	}
+	if port == 0 || port > 65535 {
+		v.add("Port", "must be between 1 and 65535, got %d", port)
+	}
+	if threads == 0 {
+		v.add("Threads", "must be greater than 0")
+	}
+	if verbose > 3 {
+		v.add("Verbose", "must be between 0 and 3, got %d", verbose)
+	}
+}
+
+// check the configuration of d. returns a *ValidationError listing every problem.
+func (d *Dumper) Validate() error {
+	v := new(ValidationError)
+
+	validateConnection(v, d.Addr, d.Port, d.Threads, d.Verbose)
+
+	if len(d.OutPutDir) == 0 {
+		v.add("OutPutDir", "must not be empty")
+	}
+	if len(d.Layout) > 0 && d.Layout != LayoutFlat && d.Layout != LayoutPerRun {
+		v.add("Layout", "must be %q or %q, got %q", LayoutFlat, LayoutPerRun, d.Layout)
+	}
+	if d.StatementSize == 0 {
+		v.add("StatementSize", "must be greater than 0")
+	}
+	if d.Rows > 0 && d.ChunkFilesize > 0 {
+		v.add("ChunkFilesize", "cannot be used together with Rows")
+	}
+	if d.Daemon && d.SnapshotInterval == 0 {
+		v.add("SnapshotInterval", "must be greater than 0 in daemon mode")
+	}
+	if d.UtcTimeZone && d.SkipUtcTimeZone {
+		v.add("UtcTimeZone", "conflicts with SkipUtcTimeZone")
+	}
+
+	for _, table := range d.Tables {
+		parts := strings.Split(table, ".")
+		if len(parts) != 2 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+			v.add("Tables", "%q is not qualified with a database, use db.table", table)
+		}
+	}
+
+	if len(d.Regex) > 0 {
+		if err := checkRegex(d.Regex); err != nil {
+			v.add("Regex", "%s", err)
+		}
+	}
+
+	if d.LockAllTables && d.NoLock {
+		v.add("LockAllTables", "conflicts with NoLock: --lock-all-tables takes the locks --no-locks skips")
+	}
+	if d.TrxConsistencyOnly && d.LessLock {
+		v.add("LessLock", "conflicts with TrxConsistencyOnly: --trx-consistency-only releases the locks --less-locking keeps for non-InnoDB tables")
+	}
+	if d.NoLock && d.LessLock {
+		v.add("LessLock", "conflicts with NoLock: --less-locking has no effect without locks")
+	}
+
+	validateCharset(v, d.Charset, d.Collation)
+
+	return v.err()
+}
+
+// check the configuration of l. returns a *ValidationError listing every problem.
+func (l *Loader) Validate() error {
+	v := new(ValidationError)
+
+	validateConnection(v, l.Addr, l.Port, l.Threads, l.Verbose)
+
+	if len(l.Directory) == 0 {
+		v.add("Directory", "must not be empty")
+	}
+	if l.QueriesPerTransaction == 0 {
+		v.add("QueriesPerTransaction", "must be greater than 0")
+	}
+
+	validateCharset(v, l.Charset, "")
+
+	return v.err()
+}
+
+func validateCharset(v *ValidationError, charset string, collation string) {
+	if len(charset) > 0 {
+		if _, err := checkCharset(charset, ""); err != nil {
+			v.add("Charset", "%s", err)
+			return
+		}
+	}
+	if len(collation) > 0 {
+		if _, err := checkCharset(charset, collation); err != nil {
+			v.add("Collation", "%s", err)
+		}
+	}
+}
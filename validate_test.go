@@ -0,0 +1,93 @@
+package mydumper
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+)
+
+func TestDumperValidate(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper := newFakeDumper(t, dir, "")
+	if err := dumper.Validate(); err != nil {
+		t.Fatalf("default configuration rejected: %s", err)
+	}
+	// tables are chunked by rows by default, see README.
+	args, err := dumper.BuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd := strings.Join(args, " "); !strings.Contains(cmd, "--rows 1000000") || strings.Contains(cmd, "--chunk-filesize") {
+		t.Errorf("unexpected default chunking: %s", cmd)
+	}
+	// PCRE go cannot compile is mydumper's to check.
+	dumper.SetRegex("^db\\.(?!tmp_)")
+	if err := dumper.Validate(); err != nil {
+		t.Errorf("PCRE regex rejected: %s", err)
+	}
+
+	dumper.Addr = ""
+	dumper.SetThreads(0)
+	dumper.SetChunkFielSize(64)
+	dumper.SetRegex("^(?!(sys)")
+	dumper.AddDatabase("dev")
+	dumper.AddTables("dev.t1", "t2")
+	dumper.Port = 0
+
+	err = dumper.Validate()
+	verr, ok := errors.Cause(err).(*ValidationError)
+	if !ok {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+
+	fields := make(map[string]bool)
+	for _, fe := range verr.Errors {
+		fields[fe.Field] = true
+	}
+	for _, field := range []string{"Addr", "Port", "Threads", "ChunkFilesize", "Regex", "Tables"} {
+		if !fields[field] {
+			t.Errorf("no error for %s in %s", field, err)
+		}
+	}
+	if len(verr.Errors) != 6 {
+		t.Errorf("expected 6 errors, got %s", err)
+	}
+
+	if err := dumper.Dump(); err == nil {
+		t.Errorf("Dump did not validate")
+	}
+}
+
+func TestLoaderValidate(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "myloader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	loader := newFakeLoader(t, dir, "")
+	if err := loader.Validate(); err != nil {
+		t.Fatalf("default configuration rejected: %s", err)
+	}
+
+	loader.SetSourceDirectory("")
+	loader.SetQueriesPerTrans(0)
+	loader.SetCharacterSet("utf9")
+
+	err = loader.Validate()
+	verr, ok := errors.Cause(err).(*ValidationError)
+	if !ok || len(verr.Errors) != 3 {
+		t.Errorf("expected 3 errors, got %v", err)
+	}
+
+	if err := loader.Load(); err == nil {
+		t.Errorf("Load did not validate")
+	}
+}
@@ -0,0 +1,153 @@
+package mydumper
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// how long "--version" may take.
+const versionTimeout = 10 * time.Second
+
+type (
+	// semantic version of mydumper/myloader.
+	Version struct {
+		Major int `json:"major"`
+		Minor int `json:"minor"`
+		Patch int `json:"patch"`
+	}
+
+	// options supported by the detected binary.
+	// when Known is false the version could not be detected and nothing is gated.
+	Capabilities struct {
+		Known bool `json:"known"`
+		// --defaults-file, used to pass the password.
+		DefaultsFile bool `json:"defaults_file"`
+		// mydumper locking options.
+		NoLocks            bool `json:"no_locks"`
+		NoBackupLocks      bool `json:"no_backup_locks"`
+		LessLocking        bool `json:"less_locking"`
+		UseSavePoints      bool `json:"use_savepoints"`
+		TrxConsistencyOnly bool `json:"trx_consistency_only"`
+		// --set-names, the session character set.
+		SetNames bool `json:"set_names"`
+		// session variables read from a [mydumper_session_variables] or
+		// [myloader_session_variables] section of the defaults file.
+		SessionVariables bool `json:"session_variables"`
+	}
+)
+
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
+
+// parse the output of "mydumper --version", e.g.
+// "mydumper 0.9.1, built against MySQL 5.5.53" or
+// "mydumper v0.15.1-3, built against MySQL 8.0.31 with SSL support".
+func ParseVersion(s string) (Version, error) {
+	m := versionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, errors.NotValidf("version %q", s)
+	}
+
+	var v Version
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	v.Patch, _ = strconv.Atoi(m[3])
+	return v, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// -1, 0 or 1 when v is older, equal or newer than o.
+func (v Version) Compare(o Version) int {
+	switch {
+	case v.Major != o.Major:
+		return compareInt(v.Major, o.Major)
+	case v.Minor != o.Minor:
+		return compareInt(v.Minor, o.Minor)
+	}
+	return compareInt(v.Patch, o.Patch)
+}
+
+// v is o or newer.
+func (v Version) AtLeast(o Version) bool {
+	return v.Compare(o) >= 0
+}
+
+func compareInt(a int, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// options supported by mydumper/myloader v.
+//   - --defaults-file was added in 0.10.0.
+//   - --set-names was added in 0.12.0.
+//   - session variables in the defaults file were added in 0.13.0.
+//   - --trx-consistency-only and --less-locking were replaced by
+//     --sync-thread-lock-mode in 0.14.0.
+func CapabilitiesFor(v Version) Capabilities {
+	c := Capabilities{Known: true}
+	c.DefaultsFile = v.AtLeast(Version{0, 10, 0})
+	c.NoLocks = true
+	c.NoBackupLocks = true
+	c.LessLocking = !v.AtLeast(Version{0, 14, 0})
+	c.UseSavePoints = true
+	c.TrxConsistencyOnly = !v.AtLeast(Version{0, 14, 0})
+	c.SetNames = v.AtLeast(Version{0, 12, 0})
+	c.SessionVariables = v.AtLeast(Version{0, 13, 0})
+	return c
+}
+
+// run "path --version". an unrecognized output returns a zero version and
+// unknown capabilities.
+func detectVersion(path string) (Version, Capabilities, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, "--version").CombinedOutput()
+	if err != nil {
+		return Version{}, Capabilities{}, errors.Annotatef(err, "%s --version", path)
+	}
+
+	v, err := ParseVersion(string(out))
+	if err != nil {
+		return Version{}, Capabilities{}, nil
+	}
+	return v, CapabilitiesFor(v), nil
+}
+
+// options of a Dumper not supported by the detected mydumper.
+func (d *Dumper) checkCapabilities() error {
+	c := d.Capabilities
+	if !c.Known {
+		return nil
+	}
+
+	unsupported := func(option string) error {
+		return errors.NotSupportedf("%s by mydumper %s", option, d.Version)
+	}
+	switch {
+	case d.NoLock && !c.NoLocks:
+		return unsupported("--no-locks")
+	case d.NoBackupLock && !c.NoBackupLocks:
+		return unsupported("--no-backup-locks")
+	case d.LessLock && !c.LessLocking:
+		return unsupported("--less-locking")
+	case d.UseSavePoints && !c.UseSavePoints:
+		return unsupported("--use-savepoints")
+	case d.TrxConsistencyOnly && !c.TrxConsistencyOnly:
+		return unsupported("--trx-consistency-only")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package mydumper
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+)
+
+func TestParseVersion(t *testing.T) {
+
+	cases := map[string]Version{
+		"mydumper 0.9.1, built against MySQL 5.5.53":                         {0, 9, 1},
+		"mydumper 0.10.0, built against MySQL 5.7.21":                        {0, 10, 0},
+		"mydumper v0.15.1-3, built against MySQL 8.0.31 with SSL support":    {0, 15, 1},
+		"myloader 0.12.7-2, built against MySQL 10.6.12-MariaDB with SSL...": {0, 12, 7},
+	}
+
+	for s, expected := range cases {
+		v, err := ParseVersion(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+			continue
+		}
+		if v != expected {
+			t.Errorf("%q: expected %s, got %s", s, expected, v)
+		}
+	}
+
+	if _, err := ParseVersion("mydumper: command not found"); err == nil {
+		t.Errorf("expected error")
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+
+	if !(Version{0, 10, 0}).AtLeast(Version{0, 9, 1}) {
+		t.Errorf("0.10.0 should be at least 0.9.1")
+	}
+	if (Version{0, 9, 1}).AtLeast(Version{0, 10, 0}) {
+		t.Errorf("0.9.1 should not be at least 0.10.0")
+	}
+	if (Version{1, 0, 0}).Compare(Version{1, 0, 0}) != 0 {
+		t.Errorf("1.0.0 should equal 1.0.0")
+	}
+}
+
+func TestCapabilitiesGating(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	dumper := newFakeDumperVersion(t, dir, "0.15.1-3", "")
+	if dumper.Version != (Version{0, 15, 1}) || !dumper.Capabilities.Known {
+		t.Fatalf("unexpected version %s", dumper.Version)
+	}
+	if dumper.TrxConsistencyOnly {
+		t.Errorf("trx consistency should default to off on 0.15.1")
+	}
+
+	if _, err := dumper.BuildArgs(); err != nil {
+		t.Errorf("default options rejected: %s", err)
+	}
+
+	dumper.SetLessLock(true)
+	if _, err := dumper.BuildArgs(); !errors.IsNotSupported(err) {
+		t.Errorf("expected not supported error, got %v", err)
+	}
+}
+
+func TestEnvCredentials(t *testing.T) {
+
+	dir := fakeDir(t)
+	defer os.RemoveAll(dir)
+
+	// 0.9.1 has no --defaults-file, the password goes through MYSQL_PWD.
+	dumper := newFakeDumperVersion(t, dir, "0.9.1",
+		"echo \"$@\" > "+dir+"/argv; echo \"$MYSQL_PWD\" > "+dir+"/env")
+	dumper.SetOutPutDir(filepath.Join(dir, "backup"))
+
+	if err := dumper.Dump(); err != nil {
+		t.Fatal(err)
+	}
+
+	argv, _ := ioutil.ReadFile(filepath.Join(dir, "argv"))
+	env, _ := ioutil.ReadFile(filepath.Join(dir, "env"))
+	if strings.Contains(string(argv), "--defaults-file") || strings.Contains(string(argv), "111111") {
+		t.Errorf("unexpected argv %q", argv)
+	}
+	if strings.TrimSpace(string(env)) != "111111" {
+		t.Errorf("MYSQL_PWD not set: %q", env)
+	}
+}